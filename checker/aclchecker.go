@@ -1,10 +1,11 @@
 package checker
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -21,16 +22,14 @@ type ACLChecker struct {
 // psth - target path
 // skips = column (:) separated list of paths to skip
 // Returns:
-// key: path, value: acl, uid, gid
+// key: path, attrs: mode, uid, gid
 // Remark: works only on linux
-func (aclc *ACLChecker) Collect(config map[string]string) {
-	if len(aclc.collected) > 0 {
-		aclc.mu.Lock()
-		aclc.collected = aclc.collected[:0]
-		aclc.mu.Unlock()
-	}
+func (aclc *ACLChecker) Collect(ctx context.Context, config map[string]string) {
 	skipPaths := strings.Split(config["skips"], ":")
 	targetPath := config["path"]
+	aclc.mu.Lock()
+	aclc.begin(estimateFiles(targetPath))
+	aclc.mu.Unlock()
 
 	// create skip map
 	skips := make(map[string]bool)
@@ -38,37 +37,54 @@ func (aclc *ACLChecker) Collect(config map[string]string) {
 		skips[dir] = true
 	}
 
-	aclc.err = filepath.Walk(targetPath, func(path string, info os.FileInfo, err0 error) error {
+	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err0 error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if skips[path] {
-			if info.IsDir() {
+			if info != nil && info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
+		if err0 != nil {
+			aclc.mu.Lock()
+			aclc.collected = appendErr(aclc.collected, path, err0)
+			aclc.status.Items++
+			aclc.mu.Unlock()
+			return nil
+		}
 		uid := info.Sys().(*syscall.Stat_t).Uid
 		gid := info.Sys().(*syscall.Stat_t).Gid
-		recline := fmt.Sprintf("%s, %d, %d", info.Mode().String(), uid, gid)
+		attrs := Attrs{
+			Mode: info.Mode().String(),
+			UID:  strconv.FormatUint(uint64(uid), 10),
+			GID:  strconv.FormatUint(uint64(gid), 10),
+		}
 		aclc.mu.Lock()
-		aclc.collected = append(aclc.collected, Pair{Key: path, Value: recline})
-		aclc.progress = path
+		aclc.collected = append(aclc.collected, Pair{Key: path, Attrs: attrs})
+		aclc.status.Items++
+		aclc.status.Message = path
 		aclc.mu.Unlock()
 		return nil
 	})
 	aclc.mu.Lock()
-	aclc.progress = "sorting..."
+	aclc.status.Message = "sorting..."
 	aclc.mu.Unlock()
+	// the walk is over, so the sort doesn't need the lock and progress can
+	// be reported meanwhile
 	sort.SliceStable(aclc.collected, func(i, j int) bool {
 		return aclc.collected[i].Key < aclc.collected[j].Key
 	})
 	aclc.mu.Lock()
-	aclc.progress = "acl collection done"
-	aclc.mu.Unlock()
+	defer aclc.mu.Unlock()
+	aclc.finish(err)
 }
 
-func (aclc *ACLChecker) Progress() string {
+func (aclc *ACLChecker) Progress() Status {
 	aclc.mu.Lock()
 	defer aclc.mu.Unlock()
-	return aclc.progress
+	return aclc.progress()
 }
 
 func (aclc *ACLChecker) GetCollected() ([]Pair, error) {
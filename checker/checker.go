@@ -1,31 +1,218 @@
 package checker
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
 // Pair is a key-value pair to hold intermediate state collection results.
+// The key identifies the item (a path, a package, a user) and the value is
+// made of its typed attributes.
 type Pair struct {
 	Key   string
-	Value string
+	Attrs Attrs
+	// Err tells why the item could not be collected.
+	Err string `json:",omitempty"`
+}
+
+// Attrs holds typed attributes of a collected item, so differences can be
+// reported per attribute. Checkers fill in only the ones that apply to them.
+type Attrs struct {
+	// File attributes
+	Type   string `json:",omitempty"` // file, dir or symlink
+	Size   int64  `json:",omitempty"`
+	Hash   string `json:",omitempty"` // md5, hex encoded
+	Target string `json:",omitempty"` // symlink target
+	MTime  int64  `json:",omitempty"` // unix time
+	// Ownership and access rights, of files and users
+	Mode string `json:",omitempty"`
+	UID  string `json:",omitempty"`
+	GID  string `json:",omitempty"`
+	// User attributes
+	Home   string `json:",omitempty"`
+	Groups string `json:",omitempty"` // sorted, comma separated group ids
+	// Package attributes
+	Name        string `json:",omitempty"`
+	Epoch       string `json:",omitempty"`
+	Version     string `json:",omitempty"`
+	Release     string `json:",omitempty"`
+	Arch        string `json:",omitempty"`
+	Vendor      string `json:",omitempty"`
+	InstallTime int64  `json:",omitempty"` // unix time
+}
+
+// timeAttrs are attributes holding unix time.
+var timeAttrs = map[string]bool{"MTime": true, "InstallTime": true}
+
+// Fields lists the names and formatted values of the attributes that are set.
+func (a Attrs) Fields() (names, values []string) {
+	v := reflect.ValueOf(a)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.IsZero() {
+			continue
+		}
+		name := v.Type().Field(i).Name
+		names = append(names, name)
+		values = append(values, FormatAttr(name, f.Interface()))
+	}
+	return names, values
+}
+
+// FormatAttr formats an attribute value for display.
+func FormatAttr(name string, value interface{}) string {
+	if t, ok := value.(int64); ok && timeAttrs[name] {
+		if t == 0 {
+			return ""
+		}
+		return time.Unix(t, 0).UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// String formats the attributes that are set as "Name: value" list.
+func (a Attrs) String() string {
+	names, values := a.Fields()
+	parts := make([]string, len(names))
+	for i := range names {
+		parts[i] = names[i] + ": " + values[i]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EVR formats package version as [epoch:]version[-release].
+func (a Attrs) EVR() string {
+	evr := a.Version
+	if a.Epoch != "" {
+		evr = a.Epoch + ":" + evr
+	}
+	if a.Release != "" {
+		evr += "-" + a.Release
+	}
+	return evr
 }
 
 func (p Pair) String() string {
-	return p.Key + ":" + p.Value
+	if p.Err != "" {
+		return p.Key + ": could not collect: " + p.Err
+	}
+	return p.Key + ": " + p.Attrs.String()
 }
 
 // Checker types which implement different types of checks.
 type Checker interface {
 	// Gather info about the relevant state of the system. (async)
-	Collect(config map[string]string)
+	// Collection stops early when the context is cancelled.
+	Collect(ctx context.Context, config map[string]string)
 	// Get current progress of the collection.
-	Progress() string
+	Progress() Status
 	// Fetch the collected system state info.
 	GetCollected() ([]Pair, error)
 	// Get error if any has occured during collection.
 	GetErr() error
 }
 
+// appendErr records that the item at key could not be collected. When
+// walking, a directory that can't be listed was already recorded when it was
+// visited, so its entry gets the error instead of a duplicate one.
+func appendErr(collected []Pair, key string, err error) []Pair {
+	if n := len(collected); n > 0 && collected[n-1].Key == key {
+		collected[n-1].Err = err.Error()
+		return collected
+	}
+	return append(collected, Pair{Key: key, Err: err.Error()})
+}
+
+// New creates a checker by its type name, e.g. "FileChecker".
+func New(name string) (Checker, error) {
+	switch name {
+	case "FileChecker":
+		return &FileChecker{}, nil
+	case "PackageChecker":
+		return &PackageChecker{}, nil
+	case "ACLChecker":
+		return &ACLChecker{}, nil
+	case "UserChecker":
+		return &UserChecker{}, nil
+	}
+	return nil, errors.New("Unknown checker: " + name)
+}
+
+// State of a collection.
+type State string
+
+const (
+	Pending   State = "pending"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// Status reports the progress of a collection.
+type Status struct {
+	State State
+	// Message describes what is being done, e.g. the path being checked.
+	Message string `json:",omitempty"`
+	// Items is the number of items processed so far.
+	Items int64
+	// Bytes is the number of bytes hashed so far.
+	Bytes int64 `json:",omitempty"`
+	// Total is the estimated number of items, 0 when unknown.
+	Total   int64 `json:",omitempty"`
+	Started time.Time
+	Ended   time.Time
+	Error   string `json:",omitempty"`
+}
+
+// Finished tells if the collection has ended, successfully or not.
+func (s Status) Finished() bool {
+	return s.State == Done || s.State == Failed || s.State == Cancelled
+}
+
 type BasicChecker struct {
 	// Tracks progress of the collection operation, since some can take a while.
-	progress string
+	status Status
 	// Collected state of the system
 	collected []Pair
 	err       error
 }
+
+// begin marks the collection as running. Callers hold the checker's lock.
+func (bc *BasicChecker) begin(total int64) {
+	bc.status = Status{State: Running, Total: total, Started: time.Now()}
+	bc.collected = bc.collected[:0]
+	bc.err = nil
+}
+
+// finish records the end of the collection and its error, if any. Callers
+// hold the checker's lock.
+func (bc *BasicChecker) finish(err error) {
+	bc.err = err
+	bc.status.Ended = time.Now()
+	bc.status.Message = ""
+	switch {
+	case err == context.Canceled:
+		bc.status.State = Cancelled
+	case err != nil:
+		bc.status.State = Failed
+	default:
+		bc.status.State = Done
+	}
+	if err != nil {
+		bc.status.Error = err.Error()
+	}
+}
+
+// progress returns the current status. Callers hold the checker's lock.
+func (bc *BasicChecker) progress() Status {
+	s := bc.status
+	if s.State == "" {
+		s.State = Pending
+	}
+	return s
+}
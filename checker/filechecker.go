@@ -1,15 +1,16 @@
 package checker
 
 import (
+	"context"
 	"crypto/md5"
-	"fmt"
+	"encoding/hex"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 )
 
 // FileChecker collects files under a given path. It can get their size and/or
@@ -24,78 +25,158 @@ type FileChecker struct {
 // Configuration expects path as the target under which to search, list
 // of directories/or files to skip (column separated string), and
 // hash flag to calculate file hashes.
-// Returns list of strings containg dir/file full name, size or
-// hash, comma separated.
-func (fc *FileChecker) Collect(config map[string]string) {
-	fc.mu.Lock()
-	fc.collected = fc.collected[:0]
-	fc.mu.Unlock()
+// Returns pairs keyed by dir/file full name with the type, size, hash,
+// symlink target and modification time attributes. Files and dirs that
+// can't be read are reported with the error.
+func (fc *FileChecker) Collect(ctx context.Context, config map[string]string) {
 	skipPaths := strings.Split(config["skips"], ":")
 	collectHash := config["hash"] == "true" || config["hash"] == "yes"
 	targetPath := config["path"]
+	fc.mu.Lock()
+	fc.begin(estimateFiles(targetPath))
+	fc.mu.Unlock()
 	// create skip map
 	skips := make(map[string]bool)
 	for _, dir := range skipPaths {
 		skips[dir] = true
 	}
-	fc.err = filepath.Walk(targetPath, func(path string, info os.FileInfo, err0 error) error {
-		var recline string
+	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err0 error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if skips[path] {
-			if info.IsDir() {
+			if info != nil && info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
+		if err0 != nil {
+			fc.recordErr(path, err0)
+			return nil
+		}
 
+		attrs := Attrs{Type: "file", MTime: info.ModTime().Unix()}
 		if info.IsDir() {
-			recline = "DIR"
+			attrs.Type = "dir"
 		} else if info.Mode()&os.ModeSymlink == os.ModeSymlink {
-			recline = "SYMLINK"
+			attrs.Type = "symlink"
+			if attrs.Target, err0 = os.Readlink(path); err0 != nil {
+				fc.recordErr(path, err0)
+				return nil
+			}
 		} else {
+			attrs.Size = info.Size()
 			if collectHash && isFileReadable(&info) {
 				f, err2 := os.OpenFile(path, os.O_RDONLY, 0666)
 				if err2 != nil {
-					return err2
+					fc.recordErr(path, err2)
+					return nil
 				}
 				defer f.Close()
 				h := md5.New()
-				if _, err3 := io.Copy(h, f); err3 != nil {
-					log.Fatal(err3) // TODO jel ovo ok?
+				n, err3 := io.Copy(h, ctxReader{ctx, f})
+				fc.mu.Lock()
+				fc.status.Bytes += n
+				fc.mu.Unlock()
+				if err3 != nil {
+					if ctx.Err() != nil {
+						return err3
+					}
+					fc.recordErr(path, err3)
+					return nil
 				}
-				recline = fmt.Sprintf("%d,%x", info.Size(), h.Sum(nil))
-			} else {
-				recline = fmt.Sprintf("%d", info.Size())
+				attrs.Hash = hex.EncodeToString(h.Sum(nil))
 			}
 		}
 		fc.mu.Lock()
-		fc.collected = append(fc.collected, Pair{Key: path, Value: recline})
-		fc.progress = "checked: " + path
+		fc.collected = append(fc.collected, Pair{Key: path, Attrs: attrs})
+		fc.status.Items++
+		fc.status.Message = "checked: " + path
 		fc.mu.Unlock()
 		return nil
 	})
 
 	fc.mu.Lock()
-	fc.progress = "sorting..."
+	fc.status.Message = "sorting..."
 	fc.mu.Unlock()
+	// the walk is over, so the sort doesn't need the lock and progress can
+	// be reported meanwhile
 	sort.SliceStable(fc.collected, func(i, j int) bool {
 		return fc.collected[i].Key < fc.collected[j].Key
 	})
 	fc.mu.Lock()
-	fc.progress = "file collection done"
-	fc.mu.Unlock()
+	defer fc.mu.Unlock()
+	fc.finish(err)
+}
+
+// recordErr reports the path as not collected.
+func (fc *FileChecker) recordErr(path string, err error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.collected = appendErr(fc.collected, path, err)
+	fc.status.Items++
+}
+
+// ctxReader stops reading once the context is done, so hashing a large file
+// doesn't hold up cancellation.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// estimateFiles estimates the number of files under the path from the used
+// inodes of its filesystem. That only counts the files under the path when
+// it is a mount point, so 0 (unknown) is returned for any other path, as
+// well as when it can't be estimated.
+func estimateFiles(path string) int64 {
+	if !isMountPoint(path) {
+		return 0
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0
+	}
+	return int64(st.Files - st.Ffree)
+}
+
+// isMountPoint tells if the path is the root of a filesystem, i.e. is on
+// another device than its parent or is the root directory.
+func isMountPoint(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return true
+	}
+	var st, pst syscall.Stat_t
+	if syscall.Stat(path, &st) != nil || syscall.Stat(parent, &pst) != nil {
+		return false
+	}
+	return st.Dev != pst.Dev
 }
 
 func isFileReadable(info *os.FileInfo) bool {
 	return (*info).Mode().String()[1] == 'r'
 }
 
-func (fc *FileChecker) Progress() string {
+func (fc *FileChecker) Progress() Status {
 	fc.mu.Lock()
 	defer fc.mu.Unlock()
-	return fc.progress
+	return fc.progress()
 }
 
 func (fc *FileChecker) GetErr() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
 	return fc.err
 }
 
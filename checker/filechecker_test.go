@@ -0,0 +1,22 @@
+package checker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEstimateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the used inodes of the filesystem say nothing about a directory in it
+	if n := estimateFiles(dir); n != 0 {
+		t.Errorf("Expected no estimate for a plain directory, got %d", n)
+	}
+	if !isMountPoint("/") {
+		t.Error("The root directory is not taken as a mount point.")
+	}
+}
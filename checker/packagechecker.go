@@ -1,56 +1,369 @@
 package checker
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
 
+// Locations of the package databases, used both for reading the installed
+// packages and for detecting which package manager a host uses.
+var (
+	rpmDBPaths     = []string{"/var/lib/rpm", "/usr/lib/sysimage/rpm"}
+	dpkgStatusPath = "/var/lib/dpkg/status"
+	dpkgInfoPath   = "/var/lib/dpkg/info"
+	apkDBPath      = "/lib/apk/db/installed"
+	pacmanDBPath   = "/var/lib/pacman/local"
+)
+
 // PackageChecker collects the list of packages and versions.
 type PackageChecker struct {
 	BasicChecker
 	mu sync.Mutex
+	// manager is the backend used for the last collection.
+	manager string
 }
 
-// Collect installed package names and versions.
-func (pmc *PackageChecker) Collect(config map[string]string) {
+// Collect installed packages with their version and install metadata.
+// Configuration expects manager to be one of: rpm, dpkg, apk, pacman or auto. With auto
+// the backend is chosen by looking for package databases on the host.
+// Returns:
+// key: package name, qualified with the architecture for rpm (name.arch) and
+// dpkg (name:arch) so multilib packages are kept apart. Versions installed
+// side by side share the key.
+// attrs: name, epoch, version, release, arch, vendor and install time
+func (pmc *PackageChecker) Collect(ctx context.Context, config map[string]string) {
+	pmc.mu.Lock()
+	pmc.begin(0)
+	pmc.mu.Unlock()
+	var pkgs []Pair
+	var err error
+	manager := strings.ToLower(config["manager"])
+	if manager == "auto" {
+		manager, err = detectManager()
+		if err != nil {
+			pmc.mu.Lock()
+			pmc.finish(err)
+			pmc.mu.Unlock()
+			return
+		}
+	}
+	pmc.mu.Lock()
+	pmc.manager = manager
+	pmc.status.Message = "reading " + manager + " database"
+	pmc.mu.Unlock()
+	switch manager {
+	case "rpm":
+		pkgs, err = collectRPM(ctx)
+	case "dpkg":
+		pkgs, err = collectDpkg()
+	case "apk":
+		pkgs, err = collectApk()
+	case "pacman":
+		pkgs, err = collectPacman(ctx)
+	default:
+		err = errors.New("Unsupported package manager: " + config["manager"])
+	}
+	// a killed package manager fails with its own error, e.g. "signal: killed"
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	sortPackages(pkgs)
 	pmc.mu.Lock()
 	defer pmc.mu.Unlock()
-	if strings.ToLower(config["manager"]) != "rpm" {
-		pmc.err = errors.New("Only RPM manager is supported.")
-		// TODO support for other package managers.
-		return
-	}
-	// rpm -qa --queryformat "%{NAME},%{VERSION}\n"
-	output, err := exec.Command("rpm", "-qa", "--queryformat",
-		`%{NAME},%{VERSION}\n`).CombinedOutput()
+	pmc.collected = append(pmc.collected, pkgs...)
+	pmc.status.Items = int64(len(pkgs))
+	pmc.status.Total = pmc.status.Items
+	pmc.finish(err)
+}
+
+// sortPackages sorts the packages by key, and packages of the same key,
+// e.g. installonly kernels or gpg-pubkey, by version. The differ pairs the
+// versions of such keys with the ones of the other hosts.
+func sortPackages(pkgs []Pair) {
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].Key != pkgs[j].Key {
+			return pkgs[i].Key < pkgs[j].Key
+		}
+		return pkgs[i].Attrs.EVR() < pkgs[j].Attrs.EVR()
+	})
+}
+
+// detectManager guesses the package manager of this host from the package
+// databases present on it. dpkg is checked first because Debian hosts may
+// carry an rpm database for the rpm tool itself, but not the other way around.
+func detectManager() (string, error) {
+	if exists(dpkgStatusPath) {
+		return "dpkg", nil
+	}
+	for _, path := range rpmDBPaths {
+		if exists(path) {
+			return "rpm", nil
+		}
+	}
+	switch {
+	case exists(apkDBPath):
+		return "apk", nil
+	case exists(pacmanDBPath):
+		return "pacman", nil
+	}
+	return "", errors.New("Could not detect package manager.")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// packagePair makes a collected pair out of package attributes. When archSep
+// is not empty the key is qualified with the architecture.
+func packagePair(a Attrs, archSep string) Pair {
+	key := a.Name
+	if archSep != "" && a.Arch != "" {
+		key += archSep + a.Arch
+	}
+	return Pair{Key: key, Attrs: a}
+}
+
+// splitVersion splits a [epoch:]version[-release] string.
+func splitVersion(s string) (epoch, version, release string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		epoch, s = s[:i], s[i+1:]
+	}
+	if i := strings.LastIndex(s, "-"); i >= 0 {
+		return epoch, s[:i], s[i+1:]
+	}
+	return epoch, s, ""
+}
+
+// rpmQueryFormat lists the fields queried from rpm, tab separated.
+const rpmQueryFormat = `%{NAME}\t%{EPOCH}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{VENDOR}\t%{INSTALLTIME}\n`
+
+// collectRPM queries the rpm database for installed packages.
+func collectRPM(ctx context.Context) ([]Pair, error) {
+	output, err := exec.CommandContext(ctx, "rpm", "-qa", "--queryformat", rpmQueryFormat).Output()
+	return parseRPMQuery(string(output)), err
+}
+
+// parseRPMQuery parses the output of rpm -qa with rpmQueryFormat. Tags that
+// are not set on a package are printed by rpm as "(none)".
+func parseRPMQuery(output string) (pkgs []Pair) {
+	for _, line := range strings.Split(output, "\n") {
+		fs := strings.Split(line, "\t")
+		if len(fs) != 7 {
+			continue
+		}
+		for i := range fs {
+			if fs[i] == "(none)" {
+				fs[i] = ""
+			}
+		}
+		installed, _ := strconv.ParseInt(fs[6], 10, 64)
+		pkgs = append(pkgs, packagePair(Attrs{
+			Name:        fs[0],
+			Epoch:       fs[1],
+			Version:     fs[2],
+			Release:     fs[3],
+			Arch:        fs[4],
+			Vendor:      fs[5],
+			InstallTime: installed,
+		}, "."))
+	}
+	return pkgs
+}
+
+// collectDpkg reads installed packages straight from the dpkg status file.
+// The status file doesn't record install time, so the modification time of
+// the package's file list is used instead.
+func collectDpkg() ([]Pair, error) {
+	f, err := os.Open(dpkgStatusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pkgs, err := parseDpkgStatus(f)
+	for i := range pkgs {
+		a := &pkgs[i].Attrs
+		info, serr := os.Stat(filepath.Join(dpkgInfoPath, a.Name+":"+a.Arch+".list"))
+		if serr != nil {
+			info, serr = os.Stat(filepath.Join(dpkgInfoPath, a.Name+".list"))
+		}
+		if serr == nil {
+			a.InstallTime = info.ModTime().Unix()
+		}
+	}
+	return pkgs, err
+}
+
+// parseDpkgStatus parses a dpkg status file. Stanzas are separated by blank
+// lines and only packages in the "installed" state are reported.
+func parseDpkgStatus(r io.Reader) (pkgs []Pair, err error) {
+	fields := make(map[string]string)
+	flush := func() {
+		status := strings.Fields(fields["Status"])
+		if fields["Package"] != "" && len(status) == 3 && status[2] == "installed" {
+			epoch, version, release := splitVersion(fields["Version"])
+			pkgs = append(pkgs, packagePair(Attrs{
+				Name:    fields["Package"],
+				Epoch:   epoch,
+				Version: version,
+				Release: release,
+				Arch:    fields["Architecture"],
+				Vendor:  fields["Maintainer"],
+			}, ":"))
+		}
+		fields = make(map[string]string)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// continuation lines belong to multi-line fields we don't need
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	flush()
+	return pkgs, scanner.Err()
+}
+
+// collectApk reads installed packages from the Alpine apk database.
+func collectApk() ([]Pair, error) {
+	f, err := os.Open(apkDBPath)
 	if err != nil {
-		pmc.err = err
-		// log.Fatal(err)
+		return nil, err
 	}
-	lines := strings.Split(string(output), "\n")
-	// convert csv output string to list of packages => collected
-	for _, line := range lines {
-		if len(line) == 0 {
+	defer f.Close()
+	return parseApkInstalled(f)
+}
+
+// parseApkInstalled parses the apk installed database. Every package is a
+// block of single letter fields (P: name, V: version, A: arch, m: maintainer)
+// and blocks are separated by blank lines. apk doesn't record install time.
+func parseApkInstalled(r io.Reader) (pkgs []Pair, err error) {
+	var a Attrs
+	var version string
+	flush := func() {
+		if a.Name != "" {
+			a.Epoch, a.Version, a.Release = splitVersion(version)
+			pkgs = append(pkgs, packagePair(a, ""))
+		}
+		a, version = Attrs{}, ""
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
 			continue
 		}
-		// log.Println("collected:", line)
-		kv := strings.Split(line, ",")
-		pmc.collected = append(pmc.collected, Pair{Key: kv[0], Value: kv[1]})
+		switch line[0] {
+		case 'P':
+			a.Name = line[2:]
+		case 'V':
+			version = line[2:]
+		case 'A':
+			a.Arch = line[2:]
+		case 'm':
+			a.Vendor = line[2:]
+		}
 	}
-	// sort collected
-	sort.SliceStable(pmc.collected, func(i, j int) bool {
-		return pmc.collected[i].Key < pmc.collected[j].Key
-	})
-	pmc.progress = "package collection done"
+	flush()
+	return pkgs, scanner.Err()
+}
+
+// collectPacman reads installed packages from the pacman local database,
+// which keeps a desc file in a directory per package.
+func collectPacman(ctx context.Context) (pkgs []Pair, err error) {
+	descs, err := filepath.Glob(filepath.Join(pacmanDBPath, "*", "desc"))
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range descs {
+		if err := ctx.Err(); err != nil {
+			return pkgs, err
+		}
+		f, err := os.Open(desc)
+		if err != nil {
+			return pkgs, err
+		}
+		p, err := parsePacmanDesc(f)
+		f.Close()
+		if err != nil {
+			return pkgs, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// parsePacmanDesc parses a single pacman desc file. Fields are written as a
+// %NAME% header followed by value lines and terminated by a blank line.
+func parsePacmanDesc(r io.Reader) (Pair, error) {
+	fields := make(map[string]string)
+	var section string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			section = ""
+		case strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%"):
+			section = strings.Trim(line, "%")
+		case section != "":
+			// keep only the first value of multi-valued fields
+			if _, ok := fields[section]; !ok {
+				fields[section] = line
+			}
+		}
+	}
+	if fields["NAME"] == "" {
+		return Pair{}, errors.New("pacman desc without a package name")
+	}
+	epoch, version, release := splitVersion(fields["VERSION"])
+	installed, _ := strconv.ParseInt(fields["INSTALLDATE"], 10, 64)
+	return packagePair(Attrs{
+		Name:        fields["NAME"],
+		Epoch:       epoch,
+		Version:     version,
+		Release:     release,
+		Arch:        fields["ARCH"],
+		Vendor:      fields["PACKAGER"],
+		InstallTime: installed,
+	}, ""), scanner.Err()
+}
+
+func (pmc *PackageChecker) Progress() Status {
+	pmc.mu.Lock()
+	defer pmc.mu.Unlock()
+	return pmc.progress()
 }
 
-func (pmc *PackageChecker) Progress() string {
+// Manager returns the package manager used for the collection.
+func (pmc *PackageChecker) Manager() string {
 	pmc.mu.Lock()
 	defer pmc.mu.Unlock()
-	return pmc.progress
+	return pmc.manager
 }
 
 func (pmc *PackageChecker) GetCollected() ([]Pair, error) {
@@ -0,0 +1,207 @@
+package checker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDpkgStatus(t *testing.T) {
+	f, err := os.Open("testdata/dpkg-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pkgs, err := parseDpkgStatus(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Pair{
+		{Key: "adduser:all", Attrs: Attrs{Name: "adduser",
+			Version: "3.118", Arch: "all",
+			Vendor: "Debian Adduser Developers <adduser@packages.debian.org>"}},
+		{Key: "libc6:amd64", Attrs: Attrs{Name: "libc6",
+			Version: "2.31", Release: "13+deb11u5", Arch: "amd64"}},
+		{Key: "openssl:amd64", Attrs: Attrs{Name: "openssl",
+			Epoch: "1", Version: "1.1.1n", Release: "0+deb11u4", Arch: "amd64"}},
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("Expected %d packages, got %d: %v", len(expected), len(pkgs), pkgs)
+	}
+	for i := range expected {
+		if pkgs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], pkgs[i])
+		}
+	}
+}
+
+func TestDetectManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedRPM, savedDpkg, savedApk, savedPacman := rpmDBPaths, dpkgStatusPath, apkDBPath, pacmanDBPath
+	defer func() {
+		rpmDBPaths, dpkgStatusPath, apkDBPath, pacmanDBPath = savedRPM, savedDpkg, savedApk, savedPacman
+	}()
+	rpmDBPaths = []string{filepath.Join(dir, "rpm")}
+	dpkgStatusPath = filepath.Join(dir, "dpkg-status")
+	apkDBPath = filepath.Join(dir, "apk-installed")
+	pacmanDBPath = filepath.Join(dir, "pacman-local")
+
+	if _, err := detectManager(); err == nil {
+		t.Error("Expected detection to fail on a host without package databases.")
+	}
+	for _, c := range []struct{ path, manager string }{
+		{pacmanDBPath, "pacman"},
+		{apkDBPath, "apk"},
+		{rpmDBPaths[0], "rpm"},
+		{dpkgStatusPath, "dpkg"},
+	} {
+		if err := ioutil.WriteFile(c.path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		manager, err := detectManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manager != c.manager {
+			t.Errorf("Expected %s, detected %s", c.manager, manager)
+		}
+	}
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	f, err := os.Open("testdata/apk-installed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pkgs, err := parseApkInstalled(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Pair{
+		{Key: "musl", Attrs: Attrs{Name: "musl", Version: "1.2.3",
+			Release: "r4", Arch: "x86_64", Vendor: "Timo Teräs <timo.teras@iki.fi>"}},
+		{Key: "busybox", Attrs: Attrs{Name: "busybox",
+			Version: "1.35.0", Release: "r29", Arch: "x86_64"}},
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("Expected %d packages, got %d: %v", len(expected), len(pkgs), pkgs)
+	}
+	for i := range expected {
+		if pkgs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], pkgs[i])
+		}
+	}
+}
+
+func TestCollectPacman(t *testing.T) {
+	saved := pacmanDBPath
+	defer func() { pacmanDBPath = saved }()
+	pacmanDBPath = "testdata/pacman-local"
+	pkgs, err := collectPacman(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Pair{
+		{Key: "bash", Attrs: Attrs{Name: "bash", Version: "5.1.016",
+			Release: "1", Arch: "x86_64", Vendor: "Felix Yan <felixonmars@archlinux.org>",
+			InstallTime: 1669890436}},
+		{Key: "glibc", Attrs: Attrs{Name: "glibc", Version: "2.36",
+			Release: "6", Arch: "x86_64"}},
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("Expected %d packages, got %d: %v", len(expected), len(pkgs), pkgs)
+	}
+	for i := range expected {
+		if pkgs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], pkgs[i])
+		}
+	}
+}
+
+func TestParseRPMQuery(t *testing.T) {
+	output := "openssl\t1\t1.0.2k\t19.el7\tx86_64\tCentOS\t1669890436\n" +
+		"glibc\t(none)\t2.17\t326.el7_9\tx86_64\tCentOS\t1669890000\n" +
+		"glibc\t(none)\t2.17\t326.el7_9\ti686\tCentOS\t1669890001\n" +
+		"gpg-pubkey\t(none)\tf4a80eb5\t53a7ff4b\t(none)\t(none)\t1669890002\n"
+	pkgs := parseRPMQuery(output)
+	expected := []Pair{
+		{Key: "openssl.x86_64", Attrs: Attrs{Name: "openssl",
+			Epoch: "1", Version: "1.0.2k", Release: "19.el7", Arch: "x86_64",
+			Vendor: "CentOS", InstallTime: 1669890436}},
+		{Key: "glibc.x86_64", Attrs: Attrs{Name: "glibc",
+			Version: "2.17", Release: "326.el7_9", Arch: "x86_64", Vendor: "CentOS",
+			InstallTime: 1669890000}},
+		{Key: "glibc.i686", Attrs: Attrs{Name: "glibc",
+			Version: "2.17", Release: "326.el7_9", Arch: "i686", Vendor: "CentOS",
+			InstallTime: 1669890001}},
+		{Key: "gpg-pubkey", Attrs: Attrs{Name: "gpg-pubkey",
+			Version: "f4a80eb5", Release: "53a7ff4b", InstallTime: 1669890002}},
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("Expected %d packages, got %d: %v", len(expected), len(pkgs), pkgs)
+	}
+	for i := range expected {
+		if pkgs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], pkgs[i])
+		}
+	}
+}
+
+func TestSortPackages(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/rpm-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs := parseRPMQuery(string(data))
+	sortPackages(pkgs)
+	expected := []string{
+		"bash.x86_64 5.1.8-6.el9_1",
+		"gpg-pubkey 350d275d-6279464b",
+		"gpg-pubkey 8483c65d-5ccc5b19",
+		"kernel.x86_64 5.14.0-284.30.1.el9_2",
+		"kernel.x86_64 5.14.0-362.8.1.el9_3",
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("Expected %d packages, got %d: %v", len(expected), len(pkgs), pkgs)
+	}
+	for i, want := range expected {
+		if got := pkgs[i].Key + " " + pkgs[i].Attrs.EVR(); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestCancelRPM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// an rpm that hangs until it is killed
+	script := "#!/bin/sh\nexec sleep 10\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "rpm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	savedPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", savedPath)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+savedPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	pmc := &PackageChecker{}
+	pmc.Collect(ctx, map[string]string{"manager": "rpm"})
+	if status := pmc.Progress(); status.State != Cancelled {
+		t.Errorf("Expected the cancelled collection to be cancelled, got %+v", status)
+	}
+	if err = pmc.GetErr(); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -1,10 +1,8 @@
 package checker
 
 import (
-	"fmt"
+	"context"
 	"io/ioutil"
-	"log"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -19,17 +17,62 @@ type UserChecker struct {
 }
 
 // Collect user info from /etc/passwd files.
-func (uc *UserChecker) Collect(config map[string]string) {
-	passwd, err := os.Open("/etc/passwd")
+// Users that can't be looked up are reported with the error instead of
+// their info.
+func (uc *UserChecker) Collect(ctx context.Context, config map[string]string) {
+	users, err := readUsers(config["Pattern"])
+	uc.mu.Lock()
+	uc.begin(int64(len(users)))
+	uc.mu.Unlock()
+
+	for _, name := range users {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		uc.add(lookupUser(name))
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	sort.SliceStable(uc.collected, func(i, j int) bool {
+		return uc.collected[i].Key < uc.collected[j].Key
+	})
+	uc.finish(err)
+}
+
+func (uc *UserChecker) add(p Pair) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.collected = append(uc.collected, p)
+	uc.status.Items++
+	uc.status.Message = p.Key
+}
+
+// lookupUser collects the info of a single user.
+func lookupUser(name string) Pair {
+	usr, err := luser.Lookup(name)
 	if err != nil {
-		log.Fatal(err)
+		return Pair{Key: name, Err: err.Error()}
 	}
-	defer passwd.Close()
-	var users []string
-	blines, err := ioutil.ReadAll(passwd)
+	attrs := Attrs{UID: usr.Uid, GID: usr.Gid, Home: usr.HomeDir}
+	groups, err := usr.GroupIds()
 	if err != nil {
-		uc.err = err
-		return
+		return Pair{Key: name, Attrs: attrs, Err: "groups: " + err.Error()}
+	}
+	sort.Strings(groups)
+	attrs.Groups = strings.Join(groups, ",")
+	return Pair{Key: usr.Username, Attrs: attrs}
+}
+
+// readUsers lists the names of users in /etc/passwd which match the pattern.
+func readUsers(pattern string) (users []string, err error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	blines, err := ioutil.ReadFile("/etc/passwd")
+	if err != nil {
+		return nil, err
 	}
 	lines := strings.Split(string(blines), "\n")
 	for _, line := range lines {
@@ -40,45 +83,17 @@ func (uc *UserChecker) Collect(config map[string]string) {
 			continue
 		}
 		comps := strings.Split(line, ":")
-		if len(comps) > 0 {
-			match, err := regexp.MatchString(config["Pattern"], comps[0])
-			if err != nil {
-				uc.err = err
-				break
-			}
-			if match {
-				users = append(users, comps[0])
-			}
-		}
-	}
-
-	uc.mu.Lock()
-	defer uc.mu.Unlock()
-	uc.collected = uc.collected[:0]
-	for _, name := range users {
-		usr, err := luser.Lookup(name)
-		if err != nil {
-			log.Fatal(err)
+		if re.MatchString(comps[0]) {
+			users = append(users, comps[0])
 		}
-		valueline := fmt.Sprintf("%s, %s, %s", usr.Uid, usr.Gid, usr.HomeDir)
-		groups, err := usr.GroupIds()
-		if err != nil {
-			log.Fatal(err)
-		}
-		gs := strings.Join(groups, ", ")
-		valueline = valueline + ", " + gs
-		uc.collected = append(uc.collected, Pair{Key: usr.Username, Value: valueline})
 	}
-	sort.SliceStable(uc.collected, func(i, j int) bool {
-		return uc.collected[i].Key < uc.collected[j].Key
-	})
-	uc.progress = "user collection done"
+	return users, nil
 }
 
-func (uc *UserChecker) Progress() string {
+func (uc *UserChecker) Progress() Status {
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
-	return uc.progress
+	return uc.progress()
 }
 
 func (uc *UserChecker) GetCollected() ([]Pair, error) {
@@ -4,18 +4,24 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pjovanovic05/drift/checker"
 	"github.com/pjovanovic05/drift/differ"
+	"github.com/pjovanovic05/drift/history"
+	"github.com/pjovanovic05/drift/snapshot"
 )
 
 // Host describes one host for checking.
@@ -25,6 +31,9 @@ type Host struct {
 	Port      int
 	SSL       bool
 	KeyVerify bool
+	// Snapshot is a snapshot file holding the state of the host. When set,
+	// the host is not contacted and the state is read from the file.
+	Snapshot string `json:",omitempty"`
 }
 
 // GetBaseURL generates base url for http(s) requests on this host.
@@ -42,414 +51,777 @@ func (h *Host) GetBaseURL() string {
 
 // RunConf holds run configuration for hosts to be checked and checks to be executed.
 type RunConf struct {
-	Left            Host
-	Right           Host
+	Left  Host
+	Right Host
+	// Hosts, when set, are compared all at once instead of Left and Right.
+	Hosts []Host
+	// Every checker config takes an optional timeout (e.g. "30m") after
+	// which the collection is stopped on the server.
 	FileCheckerConf struct {
-		Path  string `json:"path"`
-		Skips string `json:"skips"`
-		Hash  string `json:"hash"`
+		Path    string `json:"path"`
+		Skips   string `json:"skips"`
+		Hash    string `json:"hash"`
+		Timeout string `json:"timeout,omitempty"`
 	}
 	PackageCheckerConf struct {
 		Manager string `json:"manager"`
+		Timeout string `json:"timeout,omitempty"`
 	}
 	ACLCheckerConf struct {
-		Path  string `json:"path"`
-		Skips string `json:"skips"`
+		Path    string `json:"path"`
+		Skips   string `json:"skips"`
+		Timeout string `json:"timeout,omitempty"`
 	}
 	UserCheckerConf struct {
 		Pattern string
+		Timeout string `json:"timeout,omitempty"`
 	}
 }
 
-// CLI client that takes json config of hosts to target, and generates html report.
-//
-// As it is now:
-// it reads run configuration,
-// starts checkers on remote servers,
-// starts progress polling goroutines,
-// prints progress reports and waits for 'done' statuses,
-// collects results from remotes,
-// generates report using html template.
-func startClient(runConf, reportFN string) {
-	fmt.Println("Started client...")
-	var wg sync.WaitGroup
-	confStr, err := ioutil.ReadFile(runConf)
-	if err != nil {
-		log.Fatalf("Reading config file failed: %s\n", err)
-	}
-	fmt.Println("Config string:", string(confStr))
-	runConfig := RunConf{}
-	if err = json.Unmarshal(confStr, &runConfig); err != nil {
-		log.Fatalf("JSON unmarshaling failed: %s\n", err)
-	}
-	resc := make(chan StatusRep)
+// check is a checker enabled in the run configuration.
+type check struct {
+	// Name is the checker type name on the server.
+	Name string
+	// Conf is the checker configuration sent to the server.
+	Conf interface{}
+	// Report is the file name of the checker's own html report.
+	Report string
+}
 
-	// Skip https key verification on client
-	if !runConfig.Left.KeyVerify {
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
+// reportFiles are the html report file names by checker.
+var reportFiles = map[string]string{
+	"FileChecker":    "files-report.html",
+	"PackageChecker": "packages-report.html",
+	"UserChecker":    "users-report.html",
+	"ACLChecker":     "acls-report.html",
+}
 
-	// start file checkers
-	if runConfig.FileCheckerConf.Path != "" {
-		err = startFC(runConfig)
-		if err != nil {
-			log.Fatalf("Error starting FileChecker on targets: %s\n", err)
-		}
-		wg.Add(2)
-		go fetchFCProgress(runConfig.Left, resc, &wg)
-		go fetchFCProgress(runConfig.Right, resc, &wg)
-	}
+// checkOrder is the order in which checks run and are reported.
+var checkOrder = []string{"FileChecker", "PackageChecker", "UserChecker", "ACLChecker"}
 
-	if runConfig.PackageCheckerConf.Manager != "" {
-		err = startPC(runConfig)
-		if err != nil {
-			log.Fatal(err)
-		}
-		wg.Add(2)
-		go fetchPCStatus(runConfig.Left, resc, &wg)
-		go fetchPCStatus(runConfig.Right, resc, &wg)
+// checks lists the checkers which are configured to run.
+func (rc *RunConf) checks() (cs []check) {
+	confs := map[string]interface{}{}
+	if rc.FileCheckerConf.Path != "" {
+		confs["FileChecker"] = rc.FileCheckerConf
 	}
-
-	if runConfig.UserCheckerConf.Pattern != "" {
-		err = startUC(runConfig)
-		if err != nil {
-			log.Fatal(err)
-		}
-		wg.Add(2)
-		go fetchUCStatus(runConfig.Left, resc, &wg)
-		go fetchUCStatus(runConfig.Right, resc, &wg)
+	if rc.PackageCheckerConf.Manager != "" {
+		confs["PackageChecker"] = rc.PackageCheckerConf
 	}
-
-	if runConfig.ACLCheckerConf.Path != "" {
-		err = startACLC(runConfig)
-		if err != nil {
-			log.Fatal(err)
+	if rc.UserCheckerConf.Pattern != "" {
+		confs["UserChecker"] = rc.UserCheckerConf
+	}
+	if rc.ACLCheckerConf.Path != "" {
+		confs["ACLChecker"] = rc.ACLCheckerConf
+	}
+	for _, name := range checkOrder {
+		if conf, ok := confs[name]; ok {
+			cs = append(cs, check{name, conf, reportFiles[name]})
 		}
-		wg.Add(2)
-		go fetchACLCStatus(runConfig.Left, resc, &wg)
-		go fetchACLCStatus(runConfig.Right, resc, &wg)
 	}
+	return cs
+}
 
-	// closer, waits for status checks to finish
-	go func() {
-		wg.Wait()
-		close(resc)
-	}()
-
-	//print progress reports
-	for res := range resc {
-		fmt.Println(res.Host + ": " + res.Progress)
+// hosts lists the hosts to check.
+func (rc *RunConf) hosts() []Host {
+	if len(rc.Hosts) > 0 {
+		return rc.Hosts
 	}
+	return []Host{rc.Left, rc.Right}
+}
 
-	// when done, get results and make reports
-	if runConfig.FileCheckerConf.Path != "" {
-		psL, err := fetchFCResults(runConfig.Left)
-		if err != nil {
-			log.Fatal(err)
-		}
-		psR, err := fetchFCResults(runConfig.Right)
-		if err != nil {
-			log.Fatal(err)
-		}
-		ds, err := differ.Diff(psL, psR)
-		if err != nil {
-			log.Fatal(err)
-		}
+// redacted returns a copy of the configuration without the passwords.
+func (rc RunConf) redacted() RunConf {
+	rc.Left.Password, rc.Right.Password = "", ""
+	hosts := make([]Host, len(rc.Hosts))
+	for i, h := range rc.Hosts {
+		h.Password = ""
+		hosts[i] = h
+	}
+	if len(hosts) > 0 {
+		rc.Hosts = hosts
+	}
+	return rc
+}
 
-		html, err := differ.GetHtmlReport(ds)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = ioutil.WriteFile("files-report.html", []byte(html), 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
+// findHost finds a configured host by name. Left is the default.
+func (rc *RunConf) findHost(name string) (Host, bool) {
+	if name == "" {
+		return rc.Left, true
 	}
-	if runConfig.PackageCheckerConf.Manager != "" {
-		psL, err := fetchPCResults(runConfig.Left)
-		if err != nil {
-			log.Fatal(err)
-		}
-		psR, err := fetchPCResults(runConfig.Right)
-		if err != nil {
-			log.Fatal(err)
-		}
-		ds, err := differ.Diff(psL, psR)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		html, err := differ.GetHtmlReport(ds)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = ioutil.WriteFile("packages-report.html", []byte(html), 0644)
-		if err != nil {
-			log.Fatal(err)
+	for _, h := range append([]Host{rc.Left, rc.Right}, rc.Hosts...) {
+		if h.HostName == name {
+			return h, true
 		}
 	}
-	if runConfig.UserCheckerConf.Pattern != "" {
-		psL, err := fetchUCResults(runConfig.Left)
-		if err != nil {
-			log.Fatal(err)
-		}
-		psR, err := fetchUCResults(runConfig.Right)
-		if err != nil {
-			log.Fatal(err)
-		}
-		ds, err := differ.Diff(psL, psR)
-		if err != nil {
-			log.Fatal(err)
-		}
+	return Host{}, false
+}
 
-		html, err := differ.GetHtmlReport(ds)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = ioutil.WriteFile("users-report.html", []byte(html), 0644)
-		if err != nil {
-			log.Fatal(err)
+// loadSnapshots reads the snapshots of hosts given as snapshot files, in the
+// order of hosts(). Hosts without a name are named after the snapshot and
+// its file, so snapshots of one host taken at different times can be told
+// apart.
+func (rc *RunConf) loadSnapshots() []*snapshot.Snapshot {
+	hosts := []*Host{&rc.Left, &rc.Right}
+	if len(rc.Hosts) > 0 {
+		hosts = nil
+		for i := range rc.Hosts {
+			hosts = append(hosts, &rc.Hosts[i])
 		}
 	}
-	if runConfig.ACLCheckerConf.Path != "" {
-		psL, err := fetchACLCResults(runConfig.Left)
-		if err != nil {
-			log.Fatal(err)
-		}
-		psR, err := fetchACLCResults(runConfig.Right)
-		if err != nil {
-			log.Fatal(err)
-		}
-		ds, err := differ.Diff(psL, psR)
-		if err != nil {
-			log.Fatal(err)
+	snaps := make([]*snapshot.Snapshot, len(hosts))
+	for i, host := range hosts {
+		if host.Snapshot == "" {
+			continue
 		}
-		html, err := differ.GetHtmlReport(ds)
+		s, err := snapshot.Read(host.Snapshot)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("Reading snapshot failed: %s\n", err)
 		}
-		err = ioutil.WriteFile("acls-report.html", []byte(html), 0644)
-		if err != nil {
-			log.Fatal(err)
+		if host.HostName == "" {
+			host.HostName = s.Host + " (" + filepath.Base(host.Snapshot) + ")"
 		}
+		snaps[i] = &s
 	}
+	return snaps
 }
 
-// Start File checker on targets.
-func startFC(config RunConf) error {
-	body, err := json.Marshal(config.FileCheckerConf)
-	if err != nil {
-		return err
+// remoteJob is a collection job started on a host.
+type remoteJob struct {
+	host  Host
+	check check
+	ID    string
+	// err is set when the job could not be started.
+	err error
+}
+
+// collected is the result of one check on one host.
+type collected struct {
+	pairs []checker.Pair
+	err   error
+}
+
+// CLI client that takes json config of hosts to target, and generates html report.
+//
+// As it is now:
+// it reads run configuration,
+// starts collection jobs on remote servers,
+// starts progress polling goroutines,
+// shows progress bars and waits for jobs to finish,
+// collects results from remotes,
+// generates report using html template.
+//
+// It returns the exit status of the run.
+func startClient(runConf string, out reportOut, historyFN string) int {
+	fmt.Fprintln(notices, "Started client...")
+	runConfig := readRunConf(runConf)
+	out.checkFormat(runConfig)
+	snaps := runConfig.loadSnapshots()
+	hosts := runConfig.hosts()
+	skipKeyVerify(hosts[0])
+
+	checks := runConfig.checks()
+	results, managers := collect(hosts, checks, snaps)
+	crs := writeReports(runConfig, checks, results, managers, out)
+	ids := recordHistory(historyFN, hosts, checks, results, managers, snaps)
+	recordRun(historyFN, "compare", runConfig, ids, crs)
+	return exitStatus(crs, out.failOn)
+}
+
+// Exit statuses of the client runs. Fatal errors exit with 1 and bad usage
+// with 2.
+const (
+	exitNoDrift = 0
+	// exitDrift is for diffs the -fail-on policy fails on.
+	exitDrift = 3
+	// exitUncollected is for hosts or checkers that could not be collected.
+	exitUncollected = 4
+)
+
+// exitStatus tells how the run went by the summaries of its diffs. Hosts
+// that could not be collected take precedence over drift, and so do items
+// that could not be collected if the policy fails on them.
+func exitStatus(crs []history.CheckResult, p differ.Policy) int {
+	status := exitNoDrift
+	uncollected := false
+	for _, cr := range crs {
+		if len(cr.Errs) > 0 {
+			return exitUncollected
+		}
+		errs := 0
+		if s := cr.Summary; s != nil {
+			counts := map[differ.DiffType]int{differ.LEFTNEW: s.LeftNew,
+				differ.RIGHTNEW: s.RightNew, differ.DIFFERENT: s.Different}
+			for t, n := range counts {
+				if n > 0 && p.Fails(cr.Checker, differ.TypeName(t)) {
+					status = exitDrift
+				}
+			}
+			errs += s.Errors
+		}
+		if s := cr.Fleet; s != nil {
+			if s.Disagree > 0 && p.Fails(cr.Checker, differ.Disagree) {
+				status = exitDrift
+			}
+			errs += s.Errors
+		}
+		if errs > 0 && p.Fails(cr.Checker, differ.TypeName(differ.ERROR)) {
+			uncollected = true
+		}
+	}
+	if uncollected {
+		return exitUncollected
+	}
+	return status
+}
+
+// notices is where the client tells what it is doing: the progress, the
+// summaries and the files written. It is the standard error when the report
+// itself goes to the standard output.
+var notices = os.Stdout
+
+// reportOut tells where reports are written.
+type reportOut struct {
+	// file is the combined report of all checkers.
+	file string
+	// dir, when set, gets a separate report file for every checker.
+	dir string
+	// format is one of formatExts.
+	format string
+	// failOn tells which diffs fail the run and the CI reports.
+	failOn differ.Policy
+	// top is the number of differing keys listed in the summary printed
+	// after a run.
+	top int
+	// maxRows caps the rows of every checker in markdown reports.
+	maxRows int
+}
+
+// formatExts are the file extensions of the report formats.
+var formatExts = map[string]string{
+	"html":     ".html",
+	"json":     ".json",
+	"ndjson":   ".ndjson",
+	"csv":      ".csv",
+	"junit":    ".xml",
+	"sarif":    ".sarif",
+	"text":     ".txt",
+	"markdown": ".md",
+}
+
+// matrixFormats can describe the comparison of a group of hosts.
+var matrixFormats = map[string]bool{"html": true, "junit": true, "sarif": true, "text": true,
+	"markdown": true}
+
+// checkFormat fails early when the report format can't describe the run.
+func (out reportOut) checkFormat(runConfig RunConf) {
+	if !matrixFormats[out.format] && len(runConfig.Hosts) > 0 {
+		log.Fatalf("The %s format only describes the diff of two hosts\n", out.format)
 	}
-	leftURL := config.Left.GetBaseURL() + "/checkers/FileChecker/start"
-	res, err := http.Post(leftURL, "application/json", bytes.NewBuffer(body))
-	if err != nil {
+}
+
+// writeReport writes the report to the file in the format of out, or to the
+// standard output if the file is "-".
+func writeReport(fn string, out reportOut, r differ.Report) error {
+	var err error
+	f := os.Stdout
+	if fn != "-" {
+		if f, err = os.Create(fn); err != nil {
+			return err
+		}
+	}
+	switch out.format {
+	case "json":
+		err = differ.WriteJSON(f, r)
+	case "ndjson":
+		err = differ.WriteNDJSON(f, r)
+	case "csv":
+		err = differ.WriteCSV(f, r)
+	case "junit":
+		err = differ.WriteJUnit(f, r, out.failOn)
+	case "sarif":
+		err = differ.WriteSARIF(f, r, out.failOn)
+	case "text":
+		err = differ.WriteText(f, r, colorOut(f))
+	case "markdown":
+		err = differ.WriteMarkdown(f, r, out.maxRows)
+	default:
+		var html string
+		if html, err = differ.GetReport(r); err == nil {
+			_, err = f.WriteString(html)
+		}
+	}
+	if f == os.Stdout {
 		return err
 	}
-	io.Copy(os.Stdout, res.Body)
-	res.Body.Close()
-	rightURL := config.Right.GetBaseURL() + "/checkers/FileChecker/start"
-	res2, err := http.Post(rightURL, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	io.Copy(os.Stdout, res2.Body)
-	res2.Body.Close()
-
-	return nil
+	return err
 }
 
-func fetchFCProgress(host Host, resc chan<- StatusRep, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		time.Sleep(2 * time.Second)
-		res, err := http.Get(host.GetBaseURL() + "/checkers/FileChecker/status")
-		if err != nil {
+// writeReports diffs the results of every check, writes the reports and
+// returns the summaries of the diffs.
+func writeReports(runConfig RunConf, checks []check, results [][]collected,
+	managers map[string]string, out reportOut) (crs []history.CheckResult) {
+	hosts := runConfig.hosts()
+	var names []string
+	for _, host := range hosts {
+		names = append(names, host.HostName)
+	}
+	report := differ.Report{Title: strings.Join(names, " vs ")}
+	for i, c := range checks {
+		section := differ.Section{Name: c.Name}
+		cr := history.CheckResult{Checker: c.Name}
+		if len(runConfig.Hosts) > 0 {
+			mr := diffHosts(hosts, c, results[i])
+			sum := mr.Summary()
+			cr.Fleet, cr.FleetHosts, cr.Errs = &sum, mr.Hosts, mr.Errs
+			section.Multi = &mr
+		} else {
+			ds := diffPair(runConfig, c, results[i], managers)
+			sum := ds.Summary()
+			cr.Summary, cr.Changes = &sum, ds.ChangeSummary()
+			cr.Errs = make(map[string]string)
+			if ds.LeftErr != "" {
+				cr.Errs[runConfig.Left.HostName] = ds.LeftErr
+			}
+			if ds.RightErr != "" {
+				cr.Errs[runConfig.Right.HostName] = ds.RightErr
+			}
+			section.Diff = &ds
+		}
+		crs = append(crs, cr)
+		report.Sections = append(report.Sections, section)
+	}
+
+	if err := differ.WriteSummary(notices, report, out.top, colorOut(notices)); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeReport(out.file, out, report); err != nil {
+		log.Fatal(err)
+	}
+	if out.file != "-" {
+		fmt.Fprintf(notices, "Wrote report to %s\n", out.file)
+	}
+	if out.dir == "" {
+		return crs
+	}
+	if err := os.MkdirAll(out.dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	for i, section := range report.Sections {
+		fn := filepath.Join(out.dir,
+			strings.TrimSuffix(checks[i].Report, ".html")+formatExts[out.format])
+		single := differ.Report{Title: report.Title, Sections: []differ.Section{section}}
+		if err := writeReport(fn, out, single); err != nil {
 			log.Fatal(err)
 		}
-		defer res.Body.Close()
-		rep := StatusRep{}
-		err = json.NewDecoder(res.Body).Decode(&rep)
-		if err != nil {
-			log.Fatalf("Error unmarshalling status report for FileChecker: %s\n", err)
-		}
-		rep.Host = host.HostName
-		resc <- rep
-		if rep.Progress == "file collection done" {
-			break
+	}
+	fmt.Fprintf(notices, "Wrote checker reports to %s\n", out.dir)
+	return crs
+}
+
+// startSnapshot collects the state of the named host, or the Left host by
+// default, and saves it to a snapshot file.
+func startSnapshot(runConf, from, out string) {
+	runConfig := readRunConf(runConf)
+	host, ok := runConfig.findHost(from)
+	if !ok {
+		log.Fatalf("No host %s in the run configuration\n", from)
+	}
+	skipKeyVerify(host)
+	var snaps []*snapshot.Snapshot
+	if host.Snapshot != "" {
+		rc := RunConf{Hosts: []Host{host}}
+		snaps = rc.loadSnapshots()
+		host = rc.Hosts[0]
+	}
+
+	checks := runConfig.checks()
+	results, managers := collect([]Host{host}, checks, snaps)
+	s := hostSnapshot(host, 0, checks, results, managers)
+	for _, sc := range s.Checks {
+		if sc.Err != "" {
+			log.Printf("Could not collect %s: %s\n", sc.Checker, sc.Err)
 		}
 	}
+	if err := snapshot.Write(out, s); err != nil {
+		log.Fatalf("Writing snapshot failed: %s\n", err)
+	}
+	fmt.Fprintf(notices, "Saved snapshot of %s to %s\n", host.HostName, out)
+}
+
+// hostSnapshot makes a snapshot of the results of the host at index h.
+func hostSnapshot(host Host, h int, checks []check, results [][]collected,
+	managers map[string]string) snapshot.Snapshot {
+	s := snapshot.Snapshot{Host: host.HostName, Created: time.Now()}
+	for i, c := range checks {
+		s.Checks = append(s.Checks, snapshotCheck(c, results[i][h], managers[host.HostName]))
+	}
+	return s
 }
 
-func fetchFCResults(host Host) (ps []checker.Pair, err error) {
-	res, err := http.Get(host.GetBaseURL() + "/checkers/FileChecker/results")
+// snapshotCheck makes the snapshot entry of a check's result.
+func snapshotCheck(c check, res collected, manager string) snapshot.Check {
+	conf, err := checkConfig(c)
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = json.NewDecoder(res.Body).Decode(&ps)
-	return
+	sc := snapshot.Check{Checker: c.Name, Config: conf, Pairs: res.pairs}
+	if c.Name == "PackageChecker" {
+		sc.Manager = manager
+	}
+	if res.err != nil {
+		sc.Err = res.err.Error()
+	}
+	return sc
 }
 
-func startPC(config RunConf) error {
-	rbody, err := json.Marshal(config.PackageCheckerConf)
+// readRunConf reads the run configuration file.
+func readRunConf(runConf string) RunConf {
+	confStr, err := ioutil.ReadFile(runConf)
 	if err != nil {
-		return err
+		log.Fatalf("Reading config file failed: %s\n", err)
 	}
-	leftURL := config.Left.GetBaseURL() + "/checkers/PackageChecker/start"
-	res, err := http.Post(leftURL, "application/json", bytes.NewBuffer(rbody))
-	if err != nil {
-		return err
+	runConfig := RunConf{}
+	if err = json.Unmarshal(confStr, &runConfig); err != nil {
+		log.Fatalf("JSON unmarshaling failed: %s\n", err)
 	}
-	io.Copy(os.Stdout, res.Body)
-	res.Body.Close()
-	rightURL := config.Right.GetBaseURL() + "/checkers/PackageChecker/start"
-	res2, err := http.Post(rightURL, "application/json", bytes.NewBuffer(rbody))
-	if err != nil {
-		return err
+	// the passwords must not end up in logs, e.g. of CI pipelines
+	if conf, err := json.Marshal(runConfig.redacted()); err == nil {
+		fmt.Fprintln(notices, "Config string:", string(conf))
 	}
-	io.Copy(os.Stdout, res2.Body)
-	res2.Body.Close()
-	return nil
+	return runConfig
 }
 
-func fetchPCStatus(host Host, resc chan<- StatusRep, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		time.Sleep(2 * time.Second)
-		res, err := http.Get(host.GetBaseURL() + "/checkers/PackageChecker/status")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer res.Body.Close()
-		rep := StatusRep{}
-		err = json.NewDecoder(res.Body).Decode(&rep)
-		if err != nil {
-			log.Fatalf("Error unmarshalling status rep. for package checker [%s]: %s\n",
-				host.HostName, err)
+// skipKeyVerify turns off https key verification on the client, unless the
+// host asks for it.
+func skipKeyVerify(host Host) {
+	if !host.KeyVerify {
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+}
+
+// collect runs every check on every host, showing progress while waiting,
+// and returns the results by check and host, along with the package manager
+// used on each host. Hosts with a snapshot, in the order of hosts, are not
+// contacted and their results are taken from the snapshot.
+func collect(hosts []Host, checks []check, snaps []*snapshot.Snapshot) ([][]collected,
+	map[string]string) {
+	var wg sync.WaitGroup
+	resc := make(chan StatusRep)
+	remote := make([][]remoteJob, len(checks))
+	results := make([][]collected, len(checks))
+	managers := make(map[string]string)
+	started := &startedJobs{}
+	go cancelOnInterrupt(started)
+	board := newProgressBoard(notices)
+	for i, c := range checks {
+		remote[i] = make([]remoteJob, len(hosts))
+		results[i] = make([]collected, len(hosts))
+		for h, host := range hosts {
+			if h < len(snaps) && snaps[h] != nil {
+				results[i][h] = fromSnapshot(snaps[h], c)
+				if c.Name == "PackageChecker" {
+					sc, _ := snaps[h].Check(c.Name)
+					managers[host.HostName] = sc.Manager
+				}
+				continue
+			}
+			job := startRemoteJob(host, c)
+			remote[i][h] = job
+			if job.err != nil {
+				log.Printf("Error starting %s on %s: %s\n", c.Name, host.HostName, job.err)
+				continue
+			}
+			started.add(job)
+			board.add(job)
+			wg.Add(1)
+			go fetchStatus(job, resc, &wg)
 		}
-		rep.Host = host.HostName
-		resc <- rep
-		if rep.Progress == "package collection done" {
-			break
+	}
+
+	// closer, waits for status checks to finish
+	go func() {
+		wg.Wait()
+		close(resc)
+	}()
+
+	//print progress reports
+	for res := range resc {
+		board.update(res)
+		if res.Manager != "" {
+			managers[res.Host] = res.Manager
 		}
 	}
+
+	// when done, get results
+	for i := range checks {
+		for h, job := range remote[i] {
+			if job.ID == "" && job.err == nil {
+				// taken from a snapshot
+				continue
+			}
+			ps, err := fetchResults(job)
+			results[i][h] = collected{ps, err}
+			deleteRemoteJob(job)
+		}
+	}
+	return results, managers
 }
 
-func fetchPCResults(host Host) (ps []checker.Pair, err error) {
-	res, err := http.Get(host.GetBaseURL() + "/checkers/PackageChecker/results")
-	if err != nil {
-		return nil, err
+// fromSnapshot takes the result of the check from the snapshot.
+func fromSnapshot(s *snapshot.Snapshot, c check) collected {
+	sc, ok := s.Check(c.Name)
+	if !ok {
+		return collected{err: fmt.Errorf("snapshot of %s has no %s results", s.Host, c.Name)}
 	}
-	err = json.NewDecoder(res.Body).Decode(&ps)
-	return
+	if sc.Err != "" {
+		return collected{err: errors.New(sc.Err)}
+	}
+	if conf, err := checkConfig(c); err == nil && !sameConfig(conf, sc.Config) {
+		log.Printf("Warning: %s in the snapshot of %s ran with a different config: %v\n",
+			c.Name, s.Host, sc.Config)
+	}
+	return collected{pairs: sc.Pairs}
 }
 
-func startACLC(config RunConf) error {
-	rbody, err := json.Marshal(config.ACLCheckerConf)
-	if err != nil {
-		return err
+// sameConfig compares checker configs, ignoring timeouts.
+func sameConfig(x, y map[string]string) bool {
+	for _, conf := range []map[string]string{x, y} {
+		for k := range conf {
+			if k != "timeout" && x[k] != y[k] {
+				return false
+			}
+		}
 	}
-	leftURL := config.Left.GetBaseURL() + "/checkers/ACLChecker/start"
-	res, err := http.Post(leftURL, "application/json", bytes.NewBuffer(rbody))
-	if err != nil {
-		return err
+	return true
+}
+
+// diffPair diffs the results of a check on the Left and Right hosts.
+func diffPair(runConfig RunConf, c check, res []collected,
+	managers map[string]string) (ds differ.DiffResult) {
+	var err error
+	l, r := res[0], res[1]
+	if l.err != nil || r.err != nil {
+		// diffing against a missing side would show everything as new
+		ds = differ.DiffResult{Left: runConfig.Left.HostName, Right: runConfig.Right.HostName}
+		if l.err != nil {
+			ds.LeftErr = l.err.Error()
+		}
+		if r.err != nil {
+			ds.RightErr = r.err.Error()
+		}
+		log.Printf("Could not collect %s: %s %s\n", c.Name, ds.LeftErr, ds.RightErr)
+		return ds
+	}
+	if c.Name == "PackageChecker" {
+		ds, err = diffPackages(runConfig, l.pairs, r.pairs, managers)
+	} else {
+		ds, err = differ.Diff(l.pairs, r.pairs)
 	}
-	io.Copy(os.Stdout, res.Body)
-	res.Body.Close()
-	rightURL := config.Right.GetBaseURL() + "/checkers/ACLChecker/start"
-	res2, err := http.Post(rightURL, "application/json", bytes.NewBuffer(rbody))
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	io.Copy(os.Stdout, res2.Body)
-	res2.Body.Close()
-	return nil
+	ds.Left, ds.Right = runConfig.Left.HostName, runConfig.Right.HostName
+	for _, cc := range ds.ChangeSummary() {
+		fmt.Fprintf(notices, "%s: %s\n", c.Name, cc)
+	}
+	return ds
+}
+
+// diffHosts compares the results of a check on all hosts. Hosts that could
+// not be collected are reported, but left out of the comparison.
+func diffHosts(hosts []Host, c check, res []collected) differ.MultiResult {
+	var names []string
+	var sets [][]checker.Pair
+	errs := make(map[string]string)
+	for h, host := range hosts {
+		if res[h].err != nil {
+			log.Printf("Could not collect %s on %s: %s\n", c.Name, host.HostName, res[h].err)
+			errs[host.HostName] = res[h].err.Error()
+			continue
+		}
+		names = append(names, host.HostName)
+		sets = append(sets, res[h].pairs)
+	}
+	mr := differ.DiffHosts(names, sets)
+	mr.Errs = errs
+	sum := mr.Summary()
+	fmt.Fprintf(notices, "%s: hosts agree on %d keys and disagree on %d\n", c.Name, sum.Agree, sum.Disagree)
+	if sum.Errors > 0 {
+		fmt.Fprintf(notices, "%s: %d keys could not be collected on some hosts\n", c.Name, sum.Errors)
+	}
+	for h, n := range sum.Outliers {
+		if n > 0 {
+			fmt.Fprintf(notices, "%s: %s is an outlier on %d keys\n", c.Name, names[h], n)
+		}
+	}
+	return mr
+}
+
+// startedJobs tracks the jobs started on remote hosts, so they can be
+// cancelled if the client is interrupted.
+type startedJobs struct {
+	mu   sync.Mutex
+	jobs []remoteJob
+}
+
+func (sj *startedJobs) add(job remoteJob) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	sj.jobs = append(sj.jobs, job)
+}
+
+// cancelAll cancels and deletes all the started jobs on their hosts.
+func (sj *startedJobs) cancelAll() {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	for _, job := range sj.jobs {
+		deleteRemoteJob(job)
+	}
+	sj.jobs = nil
+}
+
+// cancelOnInterrupt cancels remote jobs and exits when the client gets
+// Ctrl-C or SIGTERM.
+func cancelOnInterrupt(sj *startedJobs) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	<-sigc
+	fmt.Fprintln(notices, "Interrupted, cancelling remote jobs...")
+	sj.cancelAll()
+	os.Exit(130)
+}
+
+// diffPackages diffs package lists using the version rules of the package
+// managers used on the hosts.
+func diffPackages(runConfig RunConf, psL, psR []checker.Pair,
+	managers map[string]string) (differ.DiffResult, error) {
+	mL := managers[runConfig.Left.HostName]
+	mR := managers[runConfig.Right.HostName]
+	fmt.Fprintf(notices, "Package managers: %s vs %s\n", mL, mR)
+	scheme := "rpm"
+	if mL == "dpkg" && mR == "dpkg" {
+		scheme = "dpkg"
+	}
+	ds, err := differ.DiffPackages(psL, psR, scheme)
+	if err != nil {
+		return ds, err
+	}
+	ds.Left = runConfig.Left.HostName + " (" + mL + ")"
+	ds.Right = runConfig.Right.HostName + " (" + mR + ")"
+	sum := ds.Summary()
+	fmt.Fprintf(notices, "%s is behind on %d packages, %s is behind on %d packages\n",
+		runConfig.Right.HostName, sum.LeftNewer, runConfig.Left.HostName, sum.RightNewer)
+	return ds, nil
 }
 
-func fetchACLCStatus(host Host, resc chan<- StatusRep, wg *sync.WaitGroup) {
+// startRemoteJob starts a collection job for the check on the host. If the
+// job can't be started the returned job carries the error.
+func startRemoteJob(host Host, c check) (job remoteJob) {
+	job = remoteJob{host: host, check: c}
+	var body []byte
+	conf, err := checkConfig(c)
+	if err == nil {
+		body, err = json.Marshal(JobRequest{Checker: c.Name, Config: conf})
+	}
+	if err == nil {
+		err = getJSON("POST", host.GetBaseURL()+"/jobs", body, &job)
+	}
+	job.err = err
+	return job
+}
+
+// checkConfig converts the check's config to the string map passed to the
+// checker. Checker configs are flat string structs, so they fit.
+func checkConfig(c check) (map[string]string, error) {
+	conf := make(map[string]string)
+	body, err := json.Marshal(c.Conf)
+	if err == nil {
+		err = json.Unmarshal(body, &conf)
+	}
+	return conf, err
+}
+
+// maxPollErrors is the number of polls in a row that may fail before the
+// job is given up on. A single failure is usually a network hiccup.
+const maxPollErrors = 5
+
+// fetchStatus polls the job status until collection has finished. Failed
+// polls are retried, and reported as the job's failure only after
+// maxPollErrors of them in a row.
+func fetchStatus(job remoteJob, resc chan<- StatusRep, wg *sync.WaitGroup) {
 	defer wg.Done()
+	failures := 0
 	for {
 		time.Sleep(2 * time.Second)
-		res, err := http.Get(host.GetBaseURL() + "/checkers/ACLChecker/status")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer res.Body.Close()
 		rep := StatusRep{}
-		err = json.NewDecoder(res.Body).Decode(&rep)
-		if err != nil {
-			log.Fatalf("Error unmarshalling status rep. for acl checkers [%s]: %s\n",
-				host.HostName, err)
-		}
-		rep.Host = host.HostName
+		err := getJSON("GET", job.host.GetBaseURL()+"/jobs/"+job.ID, nil, &rep)
+		if err != nil {
+			failures++
+			if failures < maxPollErrors {
+				continue
+			}
+			rep = StatusRep{ID: job.ID, Checker: job.check.Name,
+				Status: checker.Status{State: checker.Failed, Error: err.Error()}}
+		} else {
+			failures = 0
+		}
+		rep.Host = job.host.HostName
 		resc <- rep
-		if rep.Progress == "acl collection done" {
+		if rep.Finished() {
 			break
 		}
 	}
 }
 
-func fetchACLCResults(host Host) (ps []checker.Pair, err error) {
-	res, err := http.Get(host.GetBaseURL() + "/checkers/ACLChecker/results")
-	if err != nil {
-		return nil, err
+func fetchResults(job remoteJob) (ps []checker.Pair, err error) {
+	if job.err != nil {
+		return nil, job.err
 	}
-	log.Println(">>> ACLC results")
-	err = json.NewDecoder(res.Body).Decode(&ps)
+	err = getJSON("GET", job.host.GetBaseURL()+"/jobs/"+job.ID+"/results", nil, &ps)
 	return
 }
 
-func startUC(config RunConf) error {
-	rbody, err := json.Marshal(config.UserCheckerConf)
-	if err != nil {
-		return err
-	}
-	leftURL := config.Left.GetBaseURL() + "/checkers/UserChecker/start"
-	res, err := http.Post(leftURL, "application/json", bytes.NewBuffer(rbody))
+// getJSON sends a request to the server and decodes the JSON response into
+// v. Error responses are returned as errors.
+func getJSON(method, url string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	io.Copy(os.Stdout, res.Body)
-	res.Body.Close()
-	rightURL := config.Right.GetBaseURL() + "/checkers/UserChecker/start"
-	res2, err := http.Post(rightURL, "application/json", bytes.NewBuffer(rbody))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
-	io.Copy(os.Stdout, res2.Body)
-	res2.Body.Close()
-	return nil
-}
-
-func fetchUCStatus(host Host, resc chan<- StatusRep, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		time.Sleep(2 * time.Second)
-		res, err := http.Get(host.GetBaseURL() + "/checkers/UserChecker/status")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer res.Body.Close()
-		rep := StatusRep{}
-		err = json.NewDecoder(res.Body).Decode(&rep)
-		if err != nil {
-			log.Fatalf("Error unmarshalling status rep. for user checkers [%s]: %s\n",
-				host.HostName, err)
-		}
-		rep.Host = host.HostName
-		resc <- rep
-		if rep.Progress == "user collection done" {
-			break
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		errRep := ErrorRep{}
+		if json.NewDecoder(res.Body).Decode(&errRep) != nil || errRep.Error == "" {
+			return fmt.Errorf("%s %s: %s", method, req.URL.Path, res.Status)
 		}
+		return errors.New(errRep.Error)
 	}
+	return json.NewDecoder(res.Body).Decode(v)
 }
 
-func fetchUCResults(host Host) (ps []checker.Pair, err error) {
-	res, err := http.Get(host.GetBaseURL() + "/checkers/UserChecker/results")
+// deleteRemoteJob cancels the job if it is still running and frees its
+// results on the server.
+func deleteRemoteJob(job remoteJob) {
+	if job.err != nil {
+		return
+	}
+	req, err := http.NewRequest("DELETE", job.host.GetBaseURL()+"/jobs/"+job.ID, nil)
 	if err != nil {
-		return nil, err
+		return
 	}
-	log.Println(">>> UC results")
-	err = json.NewDecoder(res.Body).Decode(&ps)
-	return
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Error deleting job %s on %s: %s\n", job.ID, job.host.HostName, err)
+		return
+	}
+	res.Body.Close()
 }
@@ -0,0 +1,118 @@
+package differ
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// Change is a single attribute that differs between the sides of a line.
+type Change struct {
+	Attr  string
+	Left  string
+	Right string
+}
+
+func (c Change) String() string {
+	return c.Attr + ": " + c.Left + " -> " + c.Right
+}
+
+// Changes lists the attributes that differ between Left and Right, with
+// their values on both sides.
+func (dl DiffLine) Changes() (changes []Change) {
+	if dl.T != DIFFERENT {
+		return nil
+	}
+	lv, rv := reflect.ValueOf(dl.Left.Attrs), reflect.ValueOf(dl.Right.Attrs)
+	for _, name := range dl.Changed() {
+		changes = append(changes, Change{
+			Attr:  name,
+			Left:  checker.FormatAttr(name, lv.FieldByName(name).Interface()),
+			Right: checker.FormatAttr(name, rv.FieldByName(name).Interface()),
+		})
+	}
+	return changes
+}
+
+// aspects groups attributes by what they tell about an item, so that e.g. a
+// changed uid and a changed gid both count as a change of owner.
+var aspects = map[string]string{
+	"Type":    "type",
+	"Size":    "content",
+	"Hash":    "content",
+	"Target":  "content",
+	"Mode":    "mode",
+	"UID":     "owner",
+	"GID":     "owner",
+	"Home":    "home",
+	"Groups":  "groups",
+	"Name":    "name",
+	"Epoch":   "version",
+	"Version": "version",
+	"Release": "version",
+	"Arch":    "arch",
+	"Vendor":  "vendor",
+}
+
+// Aspects lists what makes the line different, e.g. "content" or "owner".
+// Informational attributes are left out.
+func (dl DiffLine) Aspects() []string {
+	seen := make(map[string]bool)
+	var as []string
+	for _, name := range dl.Changed() {
+		if informational[name] {
+			continue
+		}
+		a, ok := aspects[name]
+		if !ok {
+			a = strings.ToLower(name)
+		}
+		if !seen[a] {
+			seen[a] = true
+			as = append(as, a)
+		}
+	}
+	sort.Strings(as)
+	return as
+}
+
+// ChangeCount is the number of different lines that differ in exactly the
+// same aspects.
+type ChangeCount struct {
+	Aspects []string
+	Count   int
+}
+
+func (cc ChangeCount) String() string {
+	if len(cc.Aspects) == 1 {
+		return fmt.Sprintf("%d differ only in %s", cc.Count, cc.Aspects[0])
+	}
+	return fmt.Sprintf("%d differ in %s", cc.Count, strings.Join(cc.Aspects, ", "))
+}
+
+// ChangeSummary counts the different lines by the aspects they differ in,
+// most common first.
+func (dr DiffResult) ChangeSummary() (counts []ChangeCount) {
+	index := make(map[string]int)
+	for _, dl := range dr.Diffs {
+		if dl.T != DIFFERENT {
+			continue
+		}
+		as := dl.Aspects()
+		k := strings.Join(as, ",")
+		i, ok := index[k]
+		if !ok {
+			i = len(counts)
+			index[k] = i
+			counts = append(counts, ChangeCount{Aspects: as})
+		}
+		counts[i].Count++
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	return counts
+}
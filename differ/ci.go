@@ -0,0 +1,295 @@
+package differ
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The CI reports list every unexpected diff, i.e. every line that is not
+// equal and every key hosts disagree on, as far as the policy counts them,
+// so CI systems can show drift and fail the pipeline. Hosts and items that
+// could not be collected are reported as errors instead.
+
+// finding is an unexpected diff of a checker.
+type finding struct {
+	// Type is the diff type as named by TypeName, or Disagree.
+	Type string
+	Key  string
+	Text string
+}
+
+func (f finding) message() string {
+	return f.Type + " " + f.Key
+}
+
+// findings lists the diffs of a section the policy fails on and the errors
+// of hosts that could not be collected, along with the items that could not
+// be collected if the policy fails on them.
+func findings(s Section, p Policy) (fs []finding, errs []string) {
+	if dr := s.Diff; dr != nil {
+		left, right := sideName(dr.Left, "left"), sideName(dr.Right, "right")
+		if dr.LeftErr != "" {
+			errs = append(errs, "could not collect "+left+": "+dr.LeftErr)
+		}
+		if dr.RightErr != "" {
+			errs = append(errs, "could not collect "+right+": "+dr.RightErr)
+		}
+		for _, dl := range dr.Diffs {
+			if !p.Fails(s.Name, TypeName(dl.T)) {
+				continue
+			}
+			f := finding{Type: TypeName(dl.T), Key: dl.Left.Key}
+			if f.Key == "" {
+				f.Key = dl.Right.Key
+			}
+			if dl.T == ERROR {
+				// items that could not be collected are errors, not drift
+				var text []string
+				if dl.Left.Err != "" {
+					text = append(text, left+": "+dl.Left.Err)
+				}
+				if dl.Right.Err != "" {
+					text = append(text, right+": "+dl.Right.Err)
+				}
+				errs = append(errs, "could not collect "+f.Key+": "+strings.Join(text, ", "))
+				continue
+			}
+			var text []string
+			switch dl.T {
+			case DIFFERENT:
+				for _, c := range dl.Changes() {
+					text = append(text, c.String())
+				}
+			default:
+				if dl.Left.Key != "" {
+					text = append(text, left+": "+cellText(dl.Left))
+				}
+				if dl.Right.Key != "" {
+					text = append(text, right+": "+cellText(dl.Right))
+				}
+			}
+			f.Text = strings.Join(text, "\n")
+			fs = append(fs, f)
+		}
+	}
+	if mr := s.Multi; mr != nil {
+		var hosts []string
+		for host := range mr.Errs {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			errs = append(errs, "could not collect "+host+": "+mr.Errs[host])
+		}
+		for _, ml := range mr.Lines {
+			if ml.Errored() {
+				if p.Fails(s.Name, TypeName(ERROR)) {
+					var text []string
+					for i, item := range ml.Items {
+						if item.Err != "" {
+							text = append(text, mr.Hosts[i]+": "+item.Err)
+						}
+					}
+					errs = append(errs, "could not collect "+ml.Key+": "+strings.Join(text, ", "))
+				}
+				continue
+			}
+			if ml.Agree() || !p.Fails(s.Name, Disagree) {
+				continue
+			}
+			var text []string
+			for i, item := range ml.Items {
+				value := cellText(item)
+				if ml.Missing(i) {
+					value = "missing"
+				}
+				if ml.Outlier(i) {
+					value += " (outlier)"
+				}
+				text = append(text, mr.Hosts[i]+": "+value)
+			}
+			fs = append(fs, finding{Type: Disagree, Key: ml.Key,
+				Text: strings.Join(text, "\n")})
+		}
+	}
+	return fs, errs
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string         `xml:"classname,attr"`
+	Name      string         `xml:"name,attr"`
+	Failures  []junitProblem `xml:"failure"`
+	Errors    []junitProblem `xml:"error"`
+}
+
+type junitProblem struct {
+	Type    string `xml:"type,attr,omitempty"`
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// WriteJUnit writes the report as JUnit XML: a test suite for the run with a
+// test case per checker. Every unexpected diff is a failure of the checker's
+// test case, and every host or item that could not be collected an error.
+func WriteJUnit(w io.Writer, r Report, p Policy) error {
+	suite := junitSuite{Name: r.Title}
+	for _, s := range r.Sections {
+		tc := junitCase{ClassName: "drift", Name: s.Name}
+		fs, errs := findings(s, p)
+		for _, f := range fs {
+			tc.Failures = append(tc.Failures, junitProblem{Type: f.Type,
+				Message: f.message(), Text: f.Text})
+		}
+		for _, e := range errs {
+			tc.Errors = append(tc.Errors, junitProblem{Message: e})
+		}
+		suite.Tests++
+		// a test case counts once, however many problems it has
+		if len(tc.Errors) > 0 {
+			suite.Errors++
+		} else if len(tc.Failures) > 0 {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suites := junitSuites{Name: "drift", Tests: suite.Tests, Failures: suite.Failures,
+		Errors: suite.Errors, Suites: []junitSuite{suite}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool                `json:"executionSuccessful"`
+	Notifications       []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifRules are the kinds of unexpected diffs, by rule ID.
+var sarifRules = []sarifRule{
+	{"left-new", sarifMessage{"Only the left host has the item"}},
+	{"right-new", sarifMessage{"Only the right host has the item"}},
+	{"different", sarifMessage{"The hosts have different items"}},
+	{Disagree, sarifMessage{"Hosts of the group have different items"}},
+}
+
+// WriteSARIF writes the report as a SARIF 2.1.0 log with a result per
+// unexpected diff. The keys are logical locations, named after their
+// checker. Hosts that could not be collected are reported as failed tool
+// execution.
+func WriteSARIF(w io.Writer, r Report, p Policy) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{Name: "drift",
+			InformationURI: "https://github.com/pjovanovic05/drift", Rules: sarifRules}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+	inv := &run.Invocations[0]
+	for _, s := range r.Sections {
+		fs, errs := findings(s, p)
+		for _, e := range errs {
+			inv.ExecutionSuccessful = false
+			inv.Notifications = append(inv.Notifications, sarifNotification{
+				Level: "error", Message: sarifMessage{s.Name + ": " + e}})
+		}
+		for _, f := range fs {
+			text := fmt.Sprintf("%s: %s", s.Name, f.message())
+			if f.Text != "" {
+				text += "\n" + f.Text
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  f.Type,
+				Level:   "error",
+				Message: sarifMessage{text},
+				Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{
+					Name: f.Key, FullyQualifiedName: s.Name + ":" + f.Key, Kind: "resource"}}}},
+				Properties: map[string]string{"checker": s.Name, "hosts": r.Title},
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Version: "2.1.0",
+		Schema: "https://json.schemastore.org/sarif-2.1.0.json", Runs: []sarifRun{run}})
+}
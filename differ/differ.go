@@ -1,8 +1,8 @@
 package differ
 
 import (
-	"bytes"
-	"html/template"
+	"reflect"
+	"sort"
 
 	"github.com/pjovanovic05/drift/checker"
 )
@@ -14,34 +14,86 @@ const (
 	LEFTNEW
 	RIGHTNEW
 	DIFFERENT
+	// ERROR marks a key that could not be collected on one or both sides.
+	ERROR
+)
+
+// Newer tells which side holds the higher package version on a DIFFERENT
+// line. It is only set by DiffPackages.
+type Newer int
+
+const (
+	NEITHER Newer = iota
+	LEFTNEWER
+	RIGHTNEWER
 )
 
 type DiffLine struct {
 	T     DiffType
 	Left  checker.Pair
 	Right checker.Pair
+	Newer Newer
+}
+
+// Changed lists the names of attributes that differ between Left and Right.
+func (dl DiffLine) Changed() []string {
+	if dl.T != DIFFERENT {
+		return nil
+	}
+	return changedAttrs(dl.Left.Attrs, dl.Right.Attrs)
+}
+
+// informational attributes are reported when they change, but never make two
+// items different on their own.
+var informational = map[string]bool{"MTime": true, "InstallTime": true}
+
+func changedAttrs(l, r checker.Attrs) (names []string) {
+	lv, rv := reflect.ValueOf(l), reflect.ValueOf(r)
+	for i := 0; i < lv.NumField(); i++ {
+		if lv.Field(i).Interface() != rv.Field(i).Interface() {
+			names = append(names, lv.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+func sameItem(x, y checker.Pair) bool {
+	for _, name := range changedAttrs(x.Attrs, y.Attrs) {
+		if !informational[name] {
+			return false
+		}
+	}
+	return true
 }
 
 type DiffResult struct {
 	Left  string
 	Right string
 	Diffs []DiffLine
+	// LeftErr and RightErr tell why the side could not be collected at all.
+	LeftErr  string `json:",omitempty"`
+	RightErr string `json:",omitempty"`
 }
 
 // Diff checks differences between two slices of key-value pairs.
+//
+// A key may repeat, e.g. for several versions of a package installed side
+// by side. When it repeats on either side its items are paired by version
+// (see diffVersions), so hosts with a different number of versions still
+// match the versions they share.
 func Diff(x, y []checker.Pair) (dr DiffResult, err error) {
 	var i, j int
 	var diffs []DiffLine
 	xn, yn := len(x), len(y)
 	for i < xn && j < yn {
 		if x[i].Key == y[j].Key {
-			if x[i].Value == y[j].Value {
-				diffs = append(diffs, DiffLine{T: EQUAL, Left: x[i], Right: y[j]})
+			xe, ye := runEnd(x, i), runEnd(y, j)
+			if xe-i > 1 || ye-j > 1 {
+				diffs = append(diffs, diffVersions(x[i:xe], y[j:ye])...)
 			} else {
-				diffs = append(diffs, DiffLine{T: DIFFERENT, Left: x[i], Right: y[j]})
+				diffs = append(diffs, diffItems(x[i], y[j]))
 			}
-			i++
-			j++
+			i, j = xe, ye
 		} else {
 			if x[i].Key < y[j].Key {
 				diffs = append(diffs, DiffLine{T: LEFTNEW, Left: x[i]})
@@ -63,106 +115,123 @@ func Diff(x, y []checker.Pair) (dr DiffResult, err error) {
 	return dr, err
 }
 
-func GetHtmlReport(diffs DiffResult) (string, error) {
-	var outBuff bytes.Buffer
-	var diffReport = template.Must(template.New("diffreport").
-		Funcs(template.FuncMap{"showDiffType": showDiffType,
-			"checkType": checkType}).Parse(reportTemplate))
-	err := diffReport.Execute(&outBuff, diffs)
-	return outBuff.String(), err
+// diffItems compares two items of the same key.
+func diffItems(x, y checker.Pair) DiffLine {
+	switch {
+	case x.Err != "" || y.Err != "":
+		return DiffLine{T: ERROR, Left: x, Right: y}
+	case sameItem(x, y):
+		return DiffLine{T: EQUAL, Left: x, Right: y}
+	}
+	return DiffLine{T: DIFFERENT, Left: x, Right: y}
+}
+
+// runEnd returns the index after the items at i that share its key.
+func runEnd(ps []checker.Pair, i int) int {
+	j := i + 1
+	for j < len(ps) && ps[j].Key == ps[i].Key {
+		j++
+	}
+	return j
+}
+
+// byVersion sorts copies of the items of a repeated key by their
+// [epoch:]version[-release].
+func byVersion(ps []checker.Pair) []checker.Pair {
+	sorted := append([]checker.Pair(nil), ps...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Attrs.EVR() < sorted[j].Attrs.EVR()
+	})
+	return sorted
+}
+
+// diffVersions diffs the items of a key that repeats on either side. Items
+// of the same version are compared, the other versions are only on their
+// side.
+func diffVersions(x, y []checker.Pair) (diffs []DiffLine) {
+	x, y = byVersion(x), byVersion(y)
+	var i, j int
+	for i < len(x) && j < len(y) {
+		xv, yv := x[i].Attrs.EVR(), y[j].Attrs.EVR()
+		switch {
+		case xv == yv:
+			diffs = append(diffs, diffItems(x[i], y[j]))
+			i++
+			j++
+		case xv < yv:
+			diffs = append(diffs, DiffLine{T: LEFTNEW, Left: x[i]})
+			i++
+		default:
+			diffs = append(diffs, DiffLine{T: RIGHTNEW, Right: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		diffs = append(diffs, DiffLine{T: LEFTNEW, Left: x[i]})
+	}
+	for ; j < len(y); j++ {
+		diffs = append(diffs, DiffLine{T: RIGHTNEW, Right: y[j]})
+	}
+	return diffs
 }
 
-var reportTemplate = `
-<!DOCTYPE html>
-<html lang="en" dir="ltr">
-  <head>
-    <meta charset="utf-8">
-    <title>Diff view</title>
-    <link rel="stylesheet"
-      href="https://stackpath.bootstrapcdn.com/bootstrap/4.1.3/css/bootstrap.min.css"
-      integrity="sha384-MCw98/SFnGE8fJT3GXwEOngsV7Zt27NXFoaoApmYm81iuXoPkFOJwJ8ERdknLPMO"
-      crossorigin="anonymous">
-    <script src="https://code.jquery.com/jquery-3.3.1.slim.min.js"
-      integrity="sha384-q8i/X+965DzO0rT7abK41JStQIAqVgRVzpbzo5smXKp4YfRvH+8abtTE1Pi6jizo"
-      crossorigin="anonymous"></script>
-    <script src="https://cdnjs.cloudflare.com/ajax/libs/popper.js/1.14.3/umd/popper.min.js"
-      integrity="sha384-ZMP7rVo3mIykV+2+9J3UJ46jBk0WLaUAdn689aCwoqbBJiSnjAK/l8WvCWPIPm49"
-      crossorigin="anonymous"></script>
-    <script src="https://stackpath.bootstrapcdn.com/bootstrap/4.1.3/js/bootstrap.min.js"
-      integrity="sha384-ChfqqxuZUCnJSK3+MXmPNIyE6ZbWh2IMqE241rYiqJxyMiZ6OW/JmZQ5stwEULTy"
-      crossorigin="anonymous"></script>
-    <style>
-      .equal {
-        background-color: green;
-        color: white;
-      }
-      .different {
-        background-color: yellow;
-      }
-      .leftnew {
-        background-color: blue;
-        color: white;
-      }
-      .rightnew {
-        background-color: red;
-        color: white;
-      }
-      .tbar {
-        background-color: white;
-      }
-    </style>
-  </head>
-  <body>
-    <div class="fixed-top tbar">
-      Toggle:
-      <button class="btn btn-success" 
-              type="button"
-              data-toggle="collapse"
-              data-target=".equal">Equal</button>
-      <button class="btn btn-warning"
-              type="button"
-              data-toggle="collapse"
-              data-target=".different">Different</button>
-      <button class="btn btn-primary"
-              type="button"
-              data-toggle="collapse"
-              data-target=".leftnew">Left New</button>
-      <button class="btn btn-danger"
-              type="button"
-              data-toggle="collapse"
-              data-target=".rightnew">Right New</button>
-    </div>
-    <br/><br/>
-    <table class="table table-sm">
-      <thead>
-        <tr><th>left</th><th>&nbsp;</th><th>right</th></tr>
-      </thead>
-      <tbody>
-        {{range .Diffs}}
-        {{if checkType .T "="}}
-        <tr class="equal collapse">
-        {{else if checkType .T "x"}}
-        <tr class="different collapse">
-        {{else if checkType .T "<"}}
-        <tr class="leftnew collapse">
-        {{else if checkType .T ">"}}
-        <tr class="rightnew collapse">
-        {{end}}
-          <td>
-            {{.Left.Key}}<br/>
-            {{.Left.Value}}
-          </td>
-          <td>{{.T | showDiffType}}</td>
-          <td>
-            {{.Right.Key}}<br/>
-            {{.Right.Value}}
-          </td>
-        {{end}}
-      </tbody>
-    </table>
-  </body>
-</html>
-`
+// DiffPackages diffs two package lists like Diff, and additionally compares
+// versions of packages that differ to tell which side is newer. The scheme is
+// the package manager whose version rules are used (see CompareVersions).
+func DiffPackages(x, y []checker.Pair, scheme string) (DiffResult, error) {
+	dr, err := Diff(x, y)
+	if err != nil {
+		return dr, err
+	}
+	for i, dl := range dr.Diffs {
+		if dl.T != DIFFERENT {
+			continue
+		}
+		switch CompareVersions(scheme, dl.Left.Attrs.EVR(), dl.Right.Attrs.EVR()) {
+		case 1:
+			dr.Diffs[i].Newer = LEFTNEWER
+		case -1:
+			dr.Diffs[i].Newer = RIGHTNEWER
+		}
+	}
+	return dr, nil
+}
+
+// Summary holds the number of lines of each type in a diff result.
+type Summary struct {
+	Equal      int
+	Different  int
+	LeftNew    int
+	RightNew   int
+	LeftNewer  int
+	RightNewer int
+	Errors     int
+}
+
+// Summary counts the lines of each type in the diff result.
+func (dr DiffResult) Summary() (s Summary) {
+	for _, dl := range dr.Diffs {
+		switch dl.T {
+		case EQUAL:
+			s.Equal++
+		case DIFFERENT:
+			s.Different++
+		case LEFTNEW:
+			s.LeftNew++
+		case RIGHTNEW:
+			s.RightNew++
+		case ERROR:
+			s.Errors++
+		}
+		switch dl.Newer {
+		case LEFTNEWER:
+			s.LeftNewer++
+		case RIGHTNEWER:
+			s.RightNewer++
+		}
+	}
+	return s
+}
 
 func showDiffType(t DiffType) string {
 	switch t {
@@ -174,10 +243,18 @@ func showDiffType(t DiffType) string {
 		return ">"
 	case DIFFERENT:
 		return "x"
+	case ERROR:
+		return "?"
 	}
 	return "!"
 }
 
-func checkType(t DiffType, s string) bool {
-	return showDiffType(t) == s
+func showNewer(n Newer) string {
+	switch n {
+	case LEFTNEWER:
+		return " left newer"
+	case RIGHTNEWER:
+		return " right newer"
+	}
+	return ""
 }
@@ -1,7 +1,14 @@
 package differ
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/pjovanovic05/drift/checker"
@@ -27,10 +34,10 @@ func TestShowDiffType(t *testing.T) {
 
 func TestDiff(t *testing.T) {
 	// create checker pairs, calculate diff and examine the diff.
-	p1 := checker.Pair{Key: "test equal", Value: "equal"}
-	p2 := checker.Pair{Key: "test different", Value: "abc"}
-	p3 := checker.Pair{Key: "test different", Value: "abcd"}
-	p4 := checker.Pair{Key: "test leftnew", Value: "zxcv"}
+	p1 := checker.Pair{Key: "test equal", Attrs: checker.Attrs{Type: "file", Size: 5}}
+	p2 := checker.Pair{Key: "test different", Attrs: checker.Attrs{Type: "file", Size: 3}}
+	p3 := checker.Pair{Key: "test different", Attrs: checker.Attrs{Type: "file", Size: 4}}
+	p4 := checker.Pair{Key: "test leftnew", Attrs: checker.Attrs{Type: "dir"}}
 	x := []checker.Pair{p1, p2, p4}
 	y := []checker.Pair{p1, p3}
 	dres, err := Diff(x, y)
@@ -56,3 +63,494 @@ func TestDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestDiffErrors(t *testing.T) {
+	x := []checker.Pair{{Key: "/etc/shadow", Err: "permission denied"}, {Key: "/etc/x", Attrs: checker.Attrs{Size: 1}}}
+	y := []checker.Pair{{Key: "/etc/shadow", Attrs: checker.Attrs{Size: 10}}, {Key: "/etc/x", Attrs: checker.Attrs{Size: 1}}}
+	dres, err := Diff(x, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dres.Diffs[0].T != ERROR || dres.Diffs[1].T != EQUAL {
+		t.Errorf("Unexpected diff result: %v", dres.Diffs)
+	}
+	if s := dres.Summary(); s.Errors != 1 || s.Equal != 1 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+}
+
+func TestDiffAttrs(t *testing.T) {
+	x := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1, MTime: 100}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Hash: "aa", Mode: "-rw-r--r--"}},
+	}
+	y := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1, MTime: 200}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Hash: "bb", Mode: "-rw-r--r--"}},
+	}
+	dres, err := Diff(x, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dres.Diffs[0].T != EQUAL {
+		t.Errorf("Modification time alone should not make files different: %v", dres.Diffs[0])
+	}
+	if dres.Diffs[1].T != DIFFERENT {
+		t.Fatalf("Expected different hashes to differ: %v", dres.Diffs[1])
+	}
+	if changed := dres.Diffs[1].Changed(); len(changed) != 1 || changed[0] != "Hash" {
+		t.Errorf("Unexpected changed attributes: %v", changed)
+	}
+}
+
+func TestChangeSummary(t *testing.T) {
+	file := func(key, hash, uid string) checker.Pair {
+		return checker.Pair{Key: key, Attrs: checker.Attrs{Type: "file", Hash: hash, UID: uid}}
+	}
+	x := []checker.Pair{file("/a", "aa", "0"), file("/b", "bb", "0"), file("/c", "cc", "0"),
+		file("/d", "dd", "0")}
+	y := []checker.Pair{file("/a", "aa", "1"), file("/b", "bb", "1"), file("/c", "c2", "0"),
+		file("/d", "d2", "1")}
+	dres, err := Diff(x, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := dres.Diffs[2].Changes()
+	if len(changes) != 1 || changes[0] != (Change{Attr: "Hash", Left: "cc", Right: "c2"}) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+	var got []string
+	for _, cc := range dres.ChangeSummary() {
+		got = append(got, cc.String())
+	}
+	want := []string{"2 differ only in owner", "1 differ only in content",
+		"1 differ in content, owner"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Unexpected change summary: %v", got)
+	}
+}
+
+func TestDiffHosts(t *testing.T) {
+	file := func(key, hash string) checker.Pair {
+		return checker.Pair{Key: key, Attrs: checker.Attrs{Type: "file", Hash: hash}}
+	}
+	hosts := []string{"web1", "web2", "web3"}
+	sets := [][]checker.Pair{
+		{file("/a", "aa"), file("/b", "bb"), file("/c", "cc")},
+		{file("/a", "aa"), file("/b", "b2"), file("/c", "cc")},
+		{file("/a", "aa"), file("/b", "bb")},
+	}
+	mr := DiffHosts(hosts, sets)
+	if len(mr.Lines) != 3 {
+		t.Fatalf("Wrong number of lines: %d", len(mr.Lines))
+	}
+	if !mr.Lines[0].Agree() {
+		t.Errorf("Hosts should agree on /a: %v", mr.Lines[0])
+	}
+	b := mr.Lines[1]
+	if b.Agree() || b.Outlier(0) || !b.Outlier(1) || b.Outlier(2) {
+		t.Errorf("Only web2 should be an outlier on /b: %v", b)
+	}
+	c := mr.Lines[2]
+	if !c.Missing(2) || !c.Outlier(2) {
+		t.Errorf("web3 should be an outlier missing /c: %v", c)
+	}
+	s := mr.Summary()
+	if s.Agree != 1 || s.Disagree != 2 || s.Outliers[0] != 0 || s.Outliers[1] != 1 ||
+		s.Outliers[2] != 1 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+	if _, err := GetReport(Report{Title: strings.Join(hosts, ", "),
+		Sections: []Section{{Name: "FileChecker", Multi: &mr}}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDiffKernels(t *testing.T) {
+	kernel := func(release string) checker.Pair {
+		return checker.Pair{Key: "kernel.x86_64", Attrs: checker.Attrs{Name: "kernel",
+			Version: "5.14.0", Release: release, Arch: "x86_64"}}
+	}
+	bash := checker.Pair{Key: "bash.x86_64", Attrs: checker.Attrs{Name: "bash",
+		Version: "5.1.8", Arch: "x86_64"}}
+	// the host with two kernels lists them in no particular order
+	two := []checker.Pair{bash, kernel("362.el9"), kernel("284.el9")}
+	one := []checker.Pair{bash, kernel("362.el9")}
+
+	dr, err := DiffPackages(two, one, "rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DiffLine{
+		{T: EQUAL, Left: bash, Right: bash},
+		{T: LEFTNEW, Left: kernel("284.el9")},
+		{T: EQUAL, Left: kernel("362.el9"), Right: kernel("362.el9")},
+	}
+	if len(dr.Diffs) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %v", len(expected), len(dr.Diffs), dr.Diffs)
+	}
+	for i := range expected {
+		if dr.Diffs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], dr.Diffs[i])
+		}
+	}
+
+	mr := DiffHosts([]string{"two", "one"}, [][]checker.Pair{two, one})
+	if len(mr.Lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %v", len(mr.Lines), mr.Lines)
+	}
+	if !mr.Lines[1].Missing(1) || mr.Lines[1].Items[0].Attrs.Release != "284.el9" {
+		t.Errorf("Only the first host should have the 284 kernel: %v", mr.Lines[1])
+	}
+	if !mr.Lines[2].Agree() {
+		t.Errorf("Hosts should agree on the 362 kernel: %v", mr.Lines[2])
+	}
+}
+
+func TestGetReport(t *testing.T) {
+	p := checker.Pair{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1}}
+	dr, err := Diff([]checker.Pair{p}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := DiffHosts([]string{"web1", "web2"}, [][]checker.Pair{{p}, {p}})
+	html, err := GetReport(Report{Title: "web1 vs web2", Sections: []Section{
+		{Name: "FileChecker", Diff: &dr}, {Name: "ACLChecker", Multi: &mr}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`id="overview"`, `id="FileChecker"`, `id="ACLChecker"`,
+		"Hosts agree on 1"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Report is missing %s", want)
+		}
+	}
+}
+
+func TestReportData(t *testing.T) {
+	l := checker.Pair{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1}}
+	r := checker.Pair{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 2}}
+	dr, err := Diff([]checker.Pair{l}, []checker.Pair{r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.Left = "web1"
+	mr := DiffHosts([]string{"web1", "web2", "web3"},
+		[][]checker.Pair{{l}, {r}, {l}})
+	data, err := reportData([]Section{{Name: "FileChecker", Diff: &dr},
+		{Name: "ACLChecker", Multi: &mr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding,
+		strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sections []sectionData
+	if err = json.NewDecoder(zr).Decode(&sections); err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d", len(sections))
+	}
+	d := sections[0]
+	if d.Cols[0] != "web1" || d.Cols[2] != "right" || len(d.Rows) != 1 {
+		t.Fatalf("Unexpected diff section: %+v", d)
+	}
+	if row := d.Rows[0]; row.T != "x" || row.K != "/etc/a" ||
+		row.C[1] != "x; Size: 1 -> 2" {
+		t.Errorf("Unexpected diff row: %+v", row)
+	}
+	m := sections[1]
+	if row := m.Rows[0]; row.T != "x" || len(row.C) != 3 || len(row.O) != 1 || row.O[0] != 1 {
+		t.Errorf("Unexpected matrix row: %+v", row)
+	}
+}
+
+func TestExport(t *testing.T) {
+	l := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Size: 1}},
+	}
+	r := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 2}},
+		{Key: "/etc/c", Attrs: checker.Attrs{Type: "dir"}},
+	}
+	dr, err := Diff(l, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.Left, dr.Right = "web1", "web2"
+	report := Report{Title: "web1 vs web2", Sections: []Section{{Name: "FileChecker", Diff: &dr}}}
+
+	var buf bytes.Buffer
+	if err = WriteJSON(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Version  int
+		Checkers []ExportChecker
+	}
+	if err = json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != ExportVersion || len(doc.Checkers) != 1 || len(doc.Checkers[0].Lines) != 3 {
+		t.Fatalf("Unexpected JSON export: %s", buf.String())
+	}
+	a := doc.Checkers[0].Lines[0]
+	if a.Type != "different" || a.Left.Attrs.Size != 1 || a.Right.Attrs.Size != 2 ||
+		len(a.Changes) != 1 || a.Changes[0].Attr != "Size" {
+		t.Errorf("Unexpected line: %+v", a)
+	}
+	if b := doc.Checkers[0].Lines[1]; b.Type != "left-new" || b.Right != nil {
+		t.Errorf("Unexpected line: %+v", b)
+	}
+
+	buf.Reset()
+	if err = WriteNDJSON(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var c ExportLine
+	if err = json.Unmarshal([]byte(lines[2]), &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || c.Checker != "FileChecker" || c.Type != "right-new" ||
+		c.Key != "/etc/c" || c.Left != nil {
+		t.Errorf("Unexpected NDJSON export: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err = WriteCSV(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[1][1] != "different" || rows[1][4] != "Size: 1 -> 2" ||
+		rows[2][5] != "Type: file, Size: 1" || rows[3][5] != "" {
+		t.Errorf("Unexpected CSV export: %q", rows)
+	}
+
+	mr := DiffHosts([]string{"web1", "web2"}, [][]checker.Pair{l, r})
+	if WriteCSV(&buf, Report{Sections: []Section{{Name: "FileChecker", Multi: &mr}}}) == nil {
+		t.Error("Host matrix should not be exported")
+	}
+}
+
+func TestCIReports(t *testing.T) {
+	l := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Size: 1}},
+	}
+	r := []checker.Pair{{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 2}}}
+	dr, err := Diff(l, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := Diff(l, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := DiffResult{Left: "web1", Right: "web2", RightErr: "timeout"}
+	report := Report{Title: "web1 vs web2", Sections: []Section{{Name: "FileChecker", Diff: &dr},
+		{Name: "UserChecker", Diff: &same}, {Name: "ACLChecker", Diff: &failed}}}
+
+	var buf bytes.Buffer
+	if err = WriteJUnit(&buf, report, Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err = xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Errors != 1 {
+		t.Errorf("Unexpected counts: %s", buf.String())
+	}
+	cases := suites.Suites[0].Cases
+	if len(cases[0].Failures) != 2 || cases[0].Failures[0].Message != "different /etc/a" ||
+		cases[0].Failures[0].Text != "Size: 1 -> 2" || cases[0].Failures[1].Type != "left-new" {
+		t.Errorf("Unexpected failures: %+v", cases[0].Failures)
+	}
+	if len(cases[1].Failures)+len(cases[1].Errors) != 0 {
+		t.Errorf("Equal checker should pass: %+v", cases[1])
+	}
+	if len(cases[2].Errors) != 1 || cases[2].Errors[0].Message != "could not collect web2: timeout" {
+		t.Errorf("Unexpected errors: %+v", cases[2].Errors)
+	}
+
+	buf.Reset()
+	if err = WriteSARIF(&buf, report, Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err = json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	run := log.Runs[0]
+	if len(run.Results) != 2 || run.Results[0].RuleID != "different" ||
+		run.Results[0].Locations[0].LogicalLocations[0].FullyQualifiedName != "FileChecker:/etc/a" {
+		t.Errorf("Unexpected results: %+v", run.Results)
+	}
+	if run.Invocations[0].ExecutionSuccessful || len(run.Invocations[0].Notifications) != 1 {
+		t.Errorf("Unexpected invocation: %+v", run.Invocations)
+	}
+}
+
+func TestItemErrors(t *testing.T) {
+	shadow := checker.Pair{Key: "/etc/shadow", Err: "permission denied"}
+	ps := []checker.Pair{{Key: "/etc/passwd", Attrs: checker.Attrs{Type: "file"}}, shadow}
+	dr, err := Diff(ps, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := DiffHosts([]string{"web1", "web2"}, [][]checker.Pair{ps, ps})
+	if s := dr.Summary(); s.Equal != 1 || s.Errors != 1 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+	if s := mr.Summary(); s.Agree != 1 || s.Disagree != 0 || s.Errors != 1 {
+		t.Errorf("Unexpected group summary: %+v", s)
+	}
+
+	for _, s := range []Section{{Name: "FileChecker", Diff: &dr}, {Name: "FileChecker", Multi: &mr}} {
+		fs, errs := findings(s, Policy{})
+		if len(fs) != 0 || len(errs) != 1 {
+			t.Errorf("Expected the item as an error, not a finding: %v, %v", fs, errs)
+		}
+		fs, errs = findings(s, ParsePolicy("different"))
+		if len(fs)+len(errs) != 0 {
+			t.Errorf("Expected the item error to be ignored: %v, %v", fs, errs)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	all := ParsePolicy("")
+	if !all.Fails("FileChecker", "left-new") || !all.Fails("ACLChecker", Disagree) ||
+		all.Fails("FileChecker", "equal") {
+		t.Errorf("Empty policy should fail on all diffs: %+v", all)
+	}
+	p := ParsePolicy("different, right-new,PackageChecker")
+	if len(p.Types) != 2 || len(p.Checkers) != 1 {
+		t.Fatalf("Unexpected policy: %+v", p)
+	}
+	for _, c := range []struct {
+		checker, typ string
+		fails        bool
+	}{
+		{"PackageChecker", "different", true},
+		{"PackageChecker", "right-new", true},
+		{"PackageChecker", "left-new", false},
+		{"FileChecker", "different", false},
+	} {
+		if p.Fails(c.checker, c.typ) != c.fails {
+			t.Errorf("Fails(%s, %s) should be %v", c.checker, c.typ, c.fails)
+		}
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	l := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 1}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Size: 1, Mode: "0644"}},
+		{Key: "/etc/c", Attrs: checker.Attrs{Type: "file"}},
+	}
+	r := []checker.Pair{
+		{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: 2}},
+		{Key: "/etc/b", Attrs: checker.Attrs{Type: "file", Size: 2, Mode: "0600"}},
+		{Key: "/etc/d", Attrs: checker.Attrs{Type: "dir"}},
+	}
+	dr, err := Diff(l, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.Left, dr.Right = "web1", "web2"
+	report := Report{Sections: []Section{{Name: "FileChecker", Diff: &dr}}}
+
+	var buf bytes.Buffer
+	if err = WriteSummary(&buf, report, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || strings.Join(strings.Fields(lines[1]), " ") != "FileChecker 0 2 1 1 0" {
+		t.Errorf("Unexpected summary:\n%s", buf.String())
+	}
+	// /etc/b differs in content and mode, so it tops /etc/a
+	if !strings.HasPrefix(strings.TrimSpace(lines[4]), "FileChecker      /etc/b  Size: 1 -> 2") {
+		t.Errorf("Unexpected top keys:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err = WriteText(&buf, report, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `--- web1
++++ web2
+@@ FileChecker: 0 equal, 2 different, 1 left only, 1 right only, 0 errors @@
+-/etc/a  Type: file, Size: 1
++/etc/a  Type: file, Size: 2
+-/etc/b  Type: file, Size: 1, Mode: 0644
++/etc/b  Type: file, Size: 2, Mode: 0600
+-/etc/c  Type: file
++/etc/d  Type: dir
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected text diff:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err = WriteText(&buf, report, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), red+"-/etc/c  Type: file"+reset) {
+		t.Errorf("Left only items should be red:\n%q", buf.String())
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	l := []checker.Pair{
+		{Key: "/etc/a|b", Attrs: checker.Attrs{Type: "file", Size: 1, Mode: "0644"}},
+		{Key: "/etc/c", Attrs: checker.Attrs{Type: "file"}},
+		{Key: "/etc/d", Attrs: checker.Attrs{Type: "file"}},
+		{Key: "/etc/e", Attrs: checker.Attrs{Type: "file"}},
+	}
+	r := []checker.Pair{
+		{Key: "/etc/a|b", Attrs: checker.Attrs{Type: "file", Size: 2, Mode: "0644"}},
+		{Key: "/etc/e", Attrs: checker.Attrs{Type: "file"}},
+	}
+	dr, err := Diff(l, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr.Left, dr.Right = "web1", "web2"
+	same, err := Diff(r, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := Report{Title: "web1 vs web2", Sections: []Section{{Name: "FileChecker", Diff: &dr},
+		{Name: "UserChecker", Diff: &same}}}
+
+	var buf bytes.Buffer
+	if err = WriteMarkdown(&buf, report, 2); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"| FileChecker | 1 | 1 | 2 | 0 | 0 |\n",
+		"| UserChecker | 2 | 0 | 0 | 0 | 0 |\n",
+		"<summary>FileChecker, not equal: 3</summary>",
+		// only the changed attributes, with the key escaped
+		"| different | /etc/a\\|b | Size: 1 | Size: 2 |\n",
+		"| left-new | /etc/c | Type: file |  |\n",
+		"_1 more rows not shown._",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown is missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "/etc/d") || strings.Contains(md, "UserChecker, not equal") {
+		t.Errorf("Markdown should list only non-equal rows up to the cap:\n%s", md)
+	}
+}
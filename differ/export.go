@@ -0,0 +1,202 @@
+package differ
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// ExportVersion is the version of the export schema. It changes only when
+// fields are renamed or removed, not when they are added.
+const ExportVersion = 1
+
+// The export formats share their records, described by ExportLine:
+//
+// JSON is a single document:
+//
+//	{"Version": 1, "Title": "web1 vs web2", "Checkers": [{
+//	  "Checker": "FileChecker", "Left": "web1", "Right": "web2",
+//	  "LeftErr": "...", "RightErr": "...",
+//	  "Summary": {"Equal": 1, "Different": 1, ...},
+//	  "Lines": [ExportLine, ...]}]}
+//
+// NDJSON has an ExportLine per line, with its Checker set, so it can be
+// processed as it is read.
+//
+// CSV has a header row and a row per line with the columns Checker, Type,
+// Key, Newer, Changes, Left, LeftErr, Right and RightErr. The attributes of
+// the sides are written as "Name: value, ..." and the changes as
+// "Name: left -> right; ...".
+//
+// When a side could not be collected at all, NDJSON and CSV get a line of
+// type "error" with an empty key and the error on that side.
+
+// ExportLine is a line of a diff as exported.
+type ExportLine struct {
+	Checker string `json:",omitempty"`
+	// Type is one of "equal", "left-new", "right-new", "different" and
+	// "error".
+	Type string
+	Key  string
+	// Newer is "left" or "right" when that side holds the higher package
+	// version.
+	Newer string `json:",omitempty"`
+	// Left and Right are the items on both sides, null on the side that
+	// doesn't have the key. Times are in Unix seconds.
+	Left  *checker.Pair
+	Right *checker.Pair
+	// Changes are the attributes that differ, with the values formatted as
+	// in the reports.
+	Changes []Change `json:",omitempty"`
+}
+
+// ExportChecker is the diff of one checker in the JSON export.
+type ExportChecker struct {
+	Checker  string
+	Left     string
+	Right    string
+	LeftErr  string `json:",omitempty"`
+	RightErr string `json:",omitempty"`
+	Summary  Summary
+	Lines    []ExportLine
+}
+
+// errMatrix is returned when a host matrix is exported. The formats only
+// describe the diff of two hosts.
+var errMatrix = errors.New("only diffs of two hosts can be exported")
+
+// TypeName names a diff type in the exports.
+func TypeName(t DiffType) string {
+	switch t {
+	case EQUAL:
+		return "equal"
+	case LEFTNEW:
+		return "left-new"
+	case RIGHTNEW:
+		return "right-new"
+	case DIFFERENT:
+		return "different"
+	case ERROR:
+		return "error"
+	}
+	return "unknown"
+}
+
+// ExportLines converts the lines of a checker's diff, adding error lines for
+// sides that could not be collected.
+func ExportLines(checkerName string, dr DiffResult) []ExportLine {
+	lines := make([]ExportLine, 0, len(dr.Diffs))
+	if dr.LeftErr != "" {
+		lines = append(lines, ExportLine{Checker: checkerName, Type: TypeName(ERROR),
+			Left: &checker.Pair{Err: dr.LeftErr}})
+	}
+	if dr.RightErr != "" {
+		lines = append(lines, ExportLine{Checker: checkerName, Type: TypeName(ERROR),
+			Right: &checker.Pair{Err: dr.RightErr}})
+	}
+	for _, dl := range dr.Diffs {
+		el := ExportLine{Checker: checkerName, Type: TypeName(dl.T), Key: dl.Left.Key,
+			Changes: dl.Changes()}
+		if dl.Left.Key != "" || dl.Left.Err != "" {
+			left := dl.Left
+			el.Left = &left
+		}
+		if dl.Right.Key != "" || dl.Right.Err != "" {
+			right := dl.Right
+			el.Right = &right
+			el.Key = right.Key
+		}
+		switch dl.Newer {
+		case LEFTNEWER:
+			el.Newer = "left"
+		case RIGHTNEWER:
+			el.Newer = "right"
+		}
+		lines = append(lines, el)
+	}
+	return lines
+}
+
+// WriteJSON writes the diffs of the report as a single JSON document.
+func WriteJSON(w io.Writer, r Report) error {
+	doc := struct {
+		Version  int
+		Title    string
+		Checkers []ExportChecker
+	}{Version: ExportVersion, Title: r.Title, Checkers: []ExportChecker{}}
+	for _, s := range r.Sections {
+		dr := s.Diff
+		if dr == nil {
+			return errMatrix
+		}
+		var lines []ExportLine
+		for _, el := range ExportLines("", *dr) {
+			if el.Key != "" {
+				lines = append(lines, el)
+			}
+		}
+		if lines == nil {
+			lines = []ExportLine{}
+		}
+		doc.Checkers = append(doc.Checkers, ExportChecker{Checker: s.Name,
+			Left: dr.Left, Right: dr.Right, LeftErr: dr.LeftErr, RightErr: dr.RightErr,
+			Summary: dr.Summary(), Lines: lines})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// WriteNDJSON writes the lines of the report's diffs as JSON, one per line.
+func WriteNDJSON(w io.Writer, r Report) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, s := range r.Sections {
+		if s.Diff == nil {
+			return errMatrix
+		}
+		for _, el := range ExportLines(s.Name, *s.Diff) {
+			if err := enc.Encode(el); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes the lines of the report's diffs as CSV.
+func WriteCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Checker", "Type", "Key", "Newer", "Changes",
+		"Left", "LeftErr", "Right", "RightErr"})
+	for _, s := range r.Sections {
+		if s.Diff == nil {
+			return errMatrix
+		}
+		for _, el := range ExportLines(s.Name, *s.Diff) {
+			var changes []string
+			for _, c := range el.Changes {
+				changes = append(changes, c.String())
+			}
+			row := []string{el.Checker, el.Type, el.Key, el.Newer,
+				strings.Join(changes, "; ")}
+			for _, p := range []*checker.Pair{el.Left, el.Right} {
+				if p == nil {
+					row = append(row, "", "")
+				} else if p.Key == "" {
+					row = append(row, "", p.Err)
+				} else {
+					row = append(row, p.Attrs.String(), p.Err)
+				}
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,150 @@
+package differ
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// mdEscaper escapes text for a cell of a Markdown table. Angle brackets are
+// escaped as html, since the tables are inside html details.
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", "&lt;", ">", "&gt;", "&", "&amp;", "\n", " ")
+
+// WriteMarkdown writes the report as Markdown to paste into tickets: a
+// table with the counts of every checker, then a collapsible section per
+// checker with differences, listing at most maxRows of its non-equal lines,
+// or all of them if maxRows is 0. Different items show only the attributes
+// that differ.
+func WriteMarkdown(w io.Writer, r Report, maxRows int) error {
+	bw := bufio.NewWriter(w)
+	if r.Title != "" {
+		fmt.Fprintf(bw, "### %s\n\n", mdEscaper.Replace(r.Title))
+	}
+	fmt.Fprintln(bw, "| Checker | Equal | Different | Left only | Right only | Errors |")
+	fmt.Fprintln(bw, "|---|---:|---:|---:|---:|---:|")
+	for _, s := range r.Sections {
+		name := mdEscaper.Replace(s.Name)
+		if dr := s.Diff; dr != nil {
+			sum := dr.Summary()
+			fmt.Fprintf(bw, "| %s | %d | %d | %d | %d | %d |\n", name, sum.Equal,
+				sum.Different, sum.LeftNew, sum.RightNew, sum.Errors)
+		}
+		if mr := s.Multi; mr != nil {
+			sum := mr.Summary()
+			fmt.Fprintf(bw, "| %s | %d | %d | - | - | %d hosts, %d keys |\n", name, sum.Agree,
+				sum.Disagree, len(mr.Errs), sum.Errors)
+		}
+	}
+
+	for _, s := range r.Sections {
+		var errs []string
+		var head []string
+		var rows [][]string
+		if dr := s.Diff; dr != nil {
+			left, right := sideName(dr.Left, "left"), sideName(dr.Right, "right")
+			if dr.LeftErr != "" {
+				errs = append(errs, "could not collect "+left+": "+dr.LeftErr)
+			}
+			if dr.RightErr != "" {
+				errs = append(errs, "could not collect "+right+": "+dr.RightErr)
+			}
+			head = []string{"", "Key", left, right}
+			for _, dl := range dr.Diffs {
+				if dl.T == EQUAL {
+					continue
+				}
+				key := dl.Left.Key
+				if key == "" {
+					key = dl.Right.Key
+				}
+				lt, rt := cellText(dl.Left), cellText(dl.Right)
+				if dl.T == DIFFERENT {
+					lt, rt = changedText(dl)
+				}
+				typ := TypeName(dl.T)
+				if newer := showNewer(dl.Newer); newer != "" {
+					typ += "," + newer
+				}
+				rows = append(rows, []string{typ, key, lt, rt})
+			}
+		}
+		if mr := s.Multi; mr != nil {
+			var hosts []string
+			for host := range mr.Errs {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+			for _, host := range hosts {
+				errs = append(errs, "could not collect "+host+": "+mr.Errs[host])
+			}
+			head = append([]string{"Key"}, mr.Hosts...)
+			for _, ml := range mr.Lines {
+				if ml.Agree() {
+					continue
+				}
+				row := []string{ml.Key}
+				for i, item := range ml.Items {
+					value := cellText(item)
+					if ml.Missing(i) {
+						value = "missing"
+					}
+					if ml.Outlier(i) {
+						value = "outlier: " + value
+					}
+					row = append(row, value)
+				}
+				rows = append(rows, row)
+			}
+		}
+		if len(errs) == 0 && len(rows) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "\n<details>\n<summary>%s, not equal: %d</summary>\n\n",
+			html.EscapeString(s.Name), len(rows))
+		for _, e := range errs {
+			fmt.Fprintf(bw, "> %s\n\n", mdEscaper.Replace(e))
+		}
+		if len(rows) > 0 {
+			writeMdRow(bw, head)
+			fmt.Fprintln(bw, strings.Repeat("|---", len(head))+"|")
+			shown := rows
+			if maxRows > 0 && len(rows) > maxRows {
+				shown = rows[:maxRows]
+			}
+			for _, row := range shown {
+				writeMdRow(bw, row)
+			}
+			if len(shown) < len(rows) {
+				fmt.Fprintf(bw, "\n_%d more rows not shown._\n", len(rows)-len(shown))
+			}
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintln(bw, "</details>")
+	}
+	return bw.Flush()
+}
+
+func writeMdRow(w io.Writer, cells []string) {
+	fmt.Fprint(w, "|")
+	for _, c := range cells {
+		fmt.Fprintf(w, " %s |", mdEscaper.Replace(c))
+	}
+	fmt.Fprintln(w)
+}
+
+// changedText shows only the attributes that differ on both sides of the
+// line.
+func changedText(dl DiffLine) (left, right string) {
+	var l, r []string
+	for _, c := range dl.Changes() {
+		l = append(l, c.Attr+": "+c.Left)
+		r = append(r, c.Attr+": "+c.Right)
+	}
+	return strings.Join(l, ", "), strings.Join(r, ", ")
+}
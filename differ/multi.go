@@ -0,0 +1,214 @@
+package differ
+
+import (
+	"sort"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// MultiResult compares the state of several hosts at once, key by key.
+type MultiResult struct {
+	Hosts []string
+	Lines []MultiLine
+	// Errs tells why a host could not be collected at all, by host name.
+	// Such hosts are left out of Hosts.
+	Errs map[string]string `json:",omitempty"`
+}
+
+// MultiLine holds the items of one key on every host. Hosts holding the same
+// value are put in one group, groups are numbered from the biggest one.
+type MultiLine struct {
+	Key string
+	// Items are in the order of hosts. The item's key is empty on hosts
+	// which don't have it.
+	Items []checker.Pair
+	// Groups is the value group of each host.
+	Groups []int
+	// Sizes is the number of hosts in each group.
+	Sizes []int
+}
+
+// Agree tells if all hosts hold the same value.
+func (ml MultiLine) Agree() bool {
+	return len(ml.Sizes) == 1
+}
+
+// Outlier tells if the host at index i holds a minority value, i.e. one held
+// by fewer hosts than the most common value. When the most common values are
+// tied, nobody is an outlier.
+func (ml MultiLine) Outlier(i int) bool {
+	return ml.Sizes[ml.Groups[i]] < ml.Sizes[0]
+}
+
+// Errored tells if the key could not be collected on some host. Such keys
+// are collection errors, not drift, like ERROR lines of a diff.
+func (ml MultiLine) Errored() bool {
+	for _, item := range ml.Items {
+		if item.Err != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Missing tells if the host at index i doesn't have the key.
+func (ml MultiLine) Missing(i int) bool {
+	return ml.Items[i].Key == ""
+}
+
+// sameCell tells if two hosts hold the same value of a key. Having no item is
+// a value too, and items that could not be collected are equal if they
+// failed with the same error.
+func sameCell(x, y checker.Pair) bool {
+	if x.Key == "" || y.Key == "" {
+		return x.Key == y.Key
+	}
+	if x.Err != "" || y.Err != "" {
+		return x.Err == y.Err
+	}
+	return sameItem(x, y)
+}
+
+// DiffHosts compares the key sorted collections of several hosts. Every key
+// found on any host gets a line, with hosts grouped by the value they hold.
+func DiffHosts(hosts []string, sets [][]checker.Pair) MultiResult {
+	mr := MultiResult{Hosts: hosts}
+	pos := make([]int, len(sets))
+	for {
+		// the next key is the smallest one at the head of any set
+		key, found := "", false
+		for h, set := range sets {
+			if pos[h] < len(set) && (!found || set[pos[h]].Key < key) {
+				key, found = set[pos[h]].Key, true
+			}
+		}
+		if !found {
+			break
+		}
+		runs := make([][]checker.Pair, len(sets))
+		repeated := false
+		for h, set := range sets {
+			if pos[h] < len(set) && set[pos[h]].Key == key {
+				end := runEnd(set, pos[h])
+				runs[h] = set[pos[h]:end]
+				repeated = repeated || end-pos[h] > 1
+				pos[h] = end
+			}
+		}
+		if !repeated {
+			ml := MultiLine{Key: key, Items: make([]checker.Pair, len(sets))}
+			for h, run := range runs {
+				if len(run) > 0 {
+					ml.Items[h] = run[0]
+				}
+			}
+			ml.group()
+			mr.Lines = append(mr.Lines, ml)
+			continue
+		}
+		mr.Lines = append(mr.Lines, versionLines(key, runs)...)
+	}
+	return mr
+}
+
+// versionLines compares the items of a key that repeats on some host, like
+// diffVersions: every version found on any host gets a line of its own.
+func versionLines(key string, runs [][]checker.Pair) (lines []MultiLine) {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		for _, p := range run {
+			if v := p.Attrs.EVR(); !seen[v] {
+				seen[v] = true
+				versions = append(versions, v)
+			}
+		}
+	}
+	sort.Strings(versions)
+	for _, v := range versions {
+		ml := MultiLine{Key: key, Items: make([]checker.Pair, len(runs))}
+		for h, run := range runs {
+			for _, p := range run {
+				if p.Attrs.EVR() == v {
+					ml.Items[h] = p
+					break
+				}
+			}
+		}
+		ml.group()
+		lines = append(lines, ml)
+	}
+	return lines
+}
+
+// group puts hosts holding the same value in groups, biggest group first.
+func (ml *MultiLine) group() {
+	var reps []int // index of the first host in each group
+	var sizes []int
+	groups := make([]int, len(ml.Items))
+	for h, item := range ml.Items {
+		g := 0
+		for ; g < len(reps); g++ {
+			if sameCell(ml.Items[reps[g]], item) {
+				break
+			}
+		}
+		if g == len(reps) {
+			reps = append(reps, h)
+			sizes = append(sizes, 0)
+		}
+		groups[h] = g
+		sizes[g]++
+	}
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]] > sizes[order[j]]
+	})
+	rank := make([]int, len(order))
+	ml.Sizes = make([]int, len(order))
+	for r, g := range order {
+		rank[g] = r
+		ml.Sizes[r] = sizes[g]
+	}
+	for h, g := range groups {
+		groups[h] = rank[g]
+	}
+	ml.Groups = groups
+}
+
+// MultiSummary counts the keys hosts agree and disagree on.
+type MultiSummary struct {
+	Agree    int
+	Disagree int
+	// Errors is the number of keys that could not be collected on some
+	// host. They are counted neither as agreed nor as disagreed on.
+	Errors int `json:",omitempty"`
+	// Outliers is the number of keys each host is an outlier on, in the
+	// order of hosts.
+	Outliers []int
+}
+
+// Summary counts the keys hosts agree and disagree on, and the outliers.
+func (mr MultiResult) Summary() MultiSummary {
+	s := MultiSummary{Outliers: make([]int, len(mr.Hosts))}
+	for _, ml := range mr.Lines {
+		if ml.Errored() {
+			s.Errors++
+			continue
+		}
+		if ml.Agree() {
+			s.Agree++
+			continue
+		}
+		s.Disagree++
+		for h := range ml.Groups {
+			if ml.Outlier(h) {
+				s.Outliers[h]++
+			}
+		}
+	}
+	return s
+}
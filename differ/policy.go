@@ -0,0 +1,54 @@
+package differ
+
+import (
+	"strings"
+)
+
+// Disagree names keys hosts of a group disagree on, next to the diff types
+// named by TypeName.
+const Disagree = "disagree"
+
+// Policy tells which diffs are unexpected, i.e. make a run fail. Empty Types
+// or Checkers stand for all of them.
+type Policy struct {
+	// Types are diff types as named by TypeName, or Disagree.
+	Types    []string
+	Checkers []string
+}
+
+// ParsePolicy parses a comma separated list of diff types and checker
+// names, e.g. "different,right-new,FileChecker". Names that are not diff
+// types are taken as checker names.
+func ParsePolicy(s string) (p Policy) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case TypeName(LEFTNEW), TypeName(RIGHTNEW), TypeName(DIFFERENT), TypeName(ERROR),
+			Disagree:
+			p.Types = append(p.Types, name)
+		default:
+			p.Checkers = append(p.Checkers, name)
+		}
+	}
+	return p
+}
+
+// Fails tells if a diff of the type found by the checker is unexpected.
+// Equal lines never are.
+func (p Policy) Fails(checkerName, typeName string) bool {
+	if typeName == TypeName(EQUAL) {
+		return false
+	}
+	return (len(p.Types) == 0 || contains(p.Types, typeName)) &&
+		(len(p.Checkers) == 0 || contains(p.Checkers, checkerName))
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
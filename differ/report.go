@@ -0,0 +1,552 @@
+package differ
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// Report is the combined report of a run, with a section per checker.
+type Report struct {
+	Title    string
+	Sections []Section
+}
+
+// Section is the diff of one checker. Either Diff, for two hosts, or Multi,
+// for a group of hosts, is set.
+type Section struct {
+	Name  string
+	Diff  *DiffResult
+	Multi *MultiResult
+}
+
+// GetReport renders the combined report: an overview with the counts of
+// every checker, followed by a tab per checker.
+//
+// The lines of the diffs are not rendered as html, which would make the
+// browser choke on a diff of a whole filesystem. They are embedded as gzip
+// compressed JSON, decompressed by the browser and rendered as they are
+// scrolled into view.
+func GetReport(r Report) (string, error) {
+	data, err := reportData(r.Sections)
+	if err != nil {
+		return "", err
+	}
+	var outBuff bytes.Buffer
+	var report = template.Must(template.New("report").Parse(reportTemplate))
+	err = report.ExecuteTemplate(&outBuff, "report", struct {
+		Report
+		Data template.HTML
+	}{r, data})
+	return outBuff.String(), err
+}
+
+func sideName(name, side string) string {
+	if name == "" {
+		return side
+	}
+	return name
+}
+
+// sectionData holds the lines of a section as embedded for the browser.
+type sectionData struct {
+	Name string `json:"name"`
+	// Cols are the headers of the columns after the key.
+	Cols []string  `json:"cols"`
+	Rows []rowData `json:"rows"`
+}
+
+// rowData is a line of a diff, its type as shown by showDiffType. The lines
+// of a host matrix are "=" when the hosts agree and "x" when they don't.
+type rowData struct {
+	T string   `json:"t"`
+	K string   `json:"k"`
+	C []string `json:"c"`
+	// O are the indices of the cells holding a minority value.
+	O []int `json:"o,omitempty"`
+}
+
+// reportData encodes the lines of the sections as base64 of gzip compressed
+// JSON.
+func reportData(sections []Section) (template.HTML, error) {
+	data := make([]sectionData, 0, len(sections))
+	for _, s := range sections {
+		sd := sectionData{Name: s.Name, Rows: []rowData{}}
+		if dr := s.Diff; dr != nil {
+			sd.Cols = []string{sideName(dr.Left, "left"), "", sideName(dr.Right, "right")}
+			for _, dl := range dr.Diffs {
+				key := dl.Left.Key
+				if key == "" {
+					key = dl.Right.Key
+				}
+				mid := showDiffType(dl.T) + showNewer(dl.Newer)
+				for _, c := range dl.Changes() {
+					mid += "; " + c.String()
+				}
+				sd.Rows = append(sd.Rows, rowData{T: showDiffType(dl.T), K: key,
+					C: []string{cellText(dl.Left), mid, cellText(dl.Right)}})
+			}
+		}
+		if mr := s.Multi; mr != nil {
+			sd.Cols = mr.Hosts
+			for _, ml := range mr.Lines {
+				rd := rowData{T: "x", K: ml.Key}
+				if ml.Agree() {
+					rd.T = "="
+				}
+				for i, item := range ml.Items {
+					if ml.Missing(i) {
+						rd.C = append(rd.C, "missing")
+					} else {
+						rd.C = append(rd.C, cellText(item))
+					}
+					if ml.Outlier(i) {
+						rd.O = append(rd.O, i)
+					}
+				}
+				sd.Rows = append(sd.Rows, rd)
+			}
+		}
+		data = append(data, sd)
+	}
+
+	var buf bytes.Buffer
+	b64 := base64.NewEncoder(base64.StdEncoding, &buf)
+	zw := gzip.NewWriter(b64)
+	if err := json.NewEncoder(zw).Encode(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := b64.Close(); err != nil {
+		return "", err
+	}
+	// base64 holds no characters special to html
+	return template.HTML(buf.String()), nil
+}
+
+// cellText shows the attributes of an item, or why it could not be collected.
+func cellText(p checker.Pair) string {
+	switch {
+	case p.Err != "":
+		return "could not collect: " + p.Err
+	case p.Key == "":
+		return ""
+	}
+	return p.Attrs.String()
+}
+
+// reportCSS styles the reports. Reports must open on hosts without internet
+// access, so they carry their own styles instead of loading a framework.
+const reportCSS = `
+      body {
+        margin: 0 1em;
+        color: #212529;
+        font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+        font-size: 14px;
+      }
+      .table {
+        width: 100%;
+        margin-bottom: 1em;
+        border-collapse: collapse;
+      }
+      .table th, .table td {
+        padding: .3em;
+        border-top: 1px solid #dee2e6;
+        text-align: left;
+        vertical-align: top;
+      }
+      .tab-pane:not(.active) {
+        display: none;
+      }
+      .fixed-top {
+        position: fixed;
+        top: 0;
+        right: 0;
+        left: 0;
+        z-index: 10;
+        padding: .4em 1em;
+        border-bottom: 1px solid #dee2e6;
+      }
+      .btn {
+        padding: .3em .7em;
+        border: 1px solid transparent;
+        border-radius: .25em;
+        color: white;
+        font-size: inherit;
+        cursor: pointer;
+      }
+      .btn.off {
+        opacity: .4;
+      }
+      .btn-success {
+        background-color: #28a745;
+      }
+      .btn-warning {
+        background-color: #ffc107;
+        color: #212529;
+      }
+      .btn-primary {
+        background-color: #007bff;
+      }
+      .btn-danger {
+        background-color: #dc3545;
+      }
+      .btn-secondary {
+        background-color: #6c757d;
+      }
+      .alert-danger {
+        padding: .7em 1em;
+        border: 1px solid #f5c6cb;
+        border-radius: .25em;
+        background-color: #f8d7da;
+        color: #721c24;
+      }
+      .nav-tabs {
+        display: flex;
+        margin: 0 0 1em;
+        padding: 0;
+        border-bottom: 1px solid #dee2e6;
+        list-style: none;
+      }
+      .nav-link {
+        display: block;
+        margin-bottom: -1px;
+        padding: .5em 1em;
+        border: 1px solid transparent;
+        border-radius: .25em .25em 0 0;
+        color: #007bff;
+        text-decoration: none;
+      }
+      .nav-link.active {
+        border-color: #dee2e6 #dee2e6 white;
+        background-color: white;
+        color: #495057;
+      }
+      .vbody {
+        position: relative;
+        height: 70vh;
+        overflow: auto;
+      }
+      .vrow {
+        display: grid;
+        position: absolute;
+        right: 0;
+        left: 0;
+        height: 24px;
+        line-height: 24px;
+      }
+      .vhead {
+        position: static;
+        font-weight: bold;
+      }
+      .vrow > div {
+        padding: 0 .3em;
+        overflow: hidden;
+        white-space: nowrap;
+        text-overflow: ellipsis;
+      }
+      .equal {
+        background-color: green;
+        color: white;
+      }
+      .different {
+        background-color: yellow;
+      }
+      .leftnew {
+        background-color: blue;
+        color: white;
+      }
+      .rightnew, .vrow > .outlier {
+        background-color: red;
+        color: white;
+      }
+      .error {
+        background-color: gray;
+        color: white;
+      }
+      .tbar {
+        background-color: white;
+      }
+`
+
+// reportJS decodes the embedded lines of the diffs and renders the rows
+// scrolled into view, as filtered by the toolbar. It also switches the tabs.
+const reportJS = `
+      var rowHeight = 24;
+      var rowClass = {"=": "equal", "x": "different", "<": "leftnew", ">": "rightnew", "?": "error"};
+      var hidden = {"=": true};
+      var query = "";
+      var viewers = [];
+
+      function div(cls, parent, text) {
+        var el = document.createElement("div");
+        el.className = cls;
+        if (text !== undefined) {
+          el.textContent = text;
+          el.title = text;
+        }
+        parent.appendChild(el);
+        return el;
+      }
+
+      function Viewer(root, section) {
+        var self = this;
+        this.section = section;
+        this.cols = "minmax(12em, 1fr) repeat(" + section.cols.length + ", minmax(12em, 1fr))";
+        if (section.cols.length === 3 && section.cols[1] === "") {
+          this.cols = "20% 30% 20% 30%";
+        }
+        var head = div("vrow vhead", root);
+        head.style.gridTemplateColumns = this.cols;
+        div("", head, "key");
+        section.cols.forEach(function (c) {
+          div("", head, c);
+        });
+        this.body = div("vbody", root);
+        this.rows = div("", this.body);
+        this.count = div("", root);
+        this.body.addEventListener("scroll", function () {
+          self.render(false);
+        });
+        this.filter();
+      }
+
+      Viewer.prototype.filter = function () {
+        var rows = this.section.rows;
+        var q = query.toLowerCase();
+        var match = function (s) {
+          return s.toLowerCase().indexOf(q) >= 0;
+        };
+        this.shown = [];
+        for (var i = 0; i < rows.length; i++) {
+          if (hidden[rows[i].t] || q && !match(rows[i].k) && !rows[i].c.some(match)) {
+            continue;
+          }
+          this.shown.push(i);
+        }
+        this.rows.style.height = (this.shown.length * rowHeight) + "px";
+        this.count.textContent = this.shown.length + " of " + rows.length + " rows shown";
+        this.render(true);
+      };
+
+      Viewer.prototype.render = function (force) {
+        var first = Math.floor(this.body.scrollTop / rowHeight);
+        if (!force && first === this.first) {
+          return;
+        }
+        this.first = first;
+        var last = Math.min(first + Math.ceil(window.innerHeight / rowHeight) + 1, this.shown.length);
+        var cols = this.cols;
+        this.rows.textContent = "";
+        for (var i = first; i < last; i++) {
+          var r = this.section.rows[this.shown[i]];
+          var row = div("vrow " + rowClass[r.t], this.rows);
+          row.style.top = (i * rowHeight) + "px";
+          row.style.gridTemplateColumns = cols;
+          div("", row, r.k);
+          r.c.forEach(function (c, j) {
+            div(r.o && r.o.indexOf(j) >= 0 ? "outlier" : "", row, c);
+          });
+        }
+      };
+
+      function refilter() {
+        viewers.forEach(function (v) {
+          v.filter();
+        });
+      }
+
+      document.addEventListener("DOMContentLoaded", function () {
+        var status = document.getElementById("drift-status");
+        if (typeof DecompressionStream === "undefined") {
+          status.textContent = "This browser can't decompress the report data.";
+          return;
+        }
+        var data = document.getElementById("drift-data").textContent.trim();
+        fetch("data:application/octet-stream;base64," + data).then(function (res) {
+          return new Response(res.body.pipeThrough(new DecompressionStream("gzip"))).json();
+        }).then(function (sections) {
+          sections.forEach(function (s) {
+            viewers.push(new Viewer(document.getElementById("viewer-" + s.name), s));
+          });
+          status.textContent = "";
+        }).catch(function (err) {
+          status.textContent = "Could not load the report data: " + err;
+        });
+        var timer;
+        document.getElementById("search").addEventListener("input", function (e) {
+          clearTimeout(timer);
+          timer = setTimeout(function () {
+            query = e.target.value;
+            refilter();
+          }, 200);
+        });
+      });
+
+      document.addEventListener("click", function (e) {
+        var el = e.target.closest("[data-toggle]");
+        if (!el) {
+          return;
+        }
+        e.preventDefault();
+        if (el.getAttribute("data-toggle") === "filter") {
+          var t = el.getAttribute("data-type");
+          hidden[t] = !hidden[t];
+          el.classList.toggle("off", hidden[t]);
+          refilter();
+          return;
+        }
+        // tab
+        var pane = document.querySelector(el.getAttribute("href"));
+        el.closest(".nav-tabs").querySelectorAll(".nav-link").forEach(function (l) {
+          l.classList.toggle("active", l === el);
+        });
+        pane.parentNode.querySelectorAll(".tab-pane").forEach(function (p) {
+          p.classList.toggle("active", p === pane);
+        });
+      });
+`
+
+var reportTemplate = `
+{{define "diff"}}
+    {{if .LeftErr}}
+    <p class="alert alert-danger">Could not collect {{if .Left}}{{.Left}}{{else}}left{{end}}: {{.LeftErr}}</p>
+    {{end}}
+    {{if .RightErr}}
+    <p class="alert alert-danger">Could not collect {{if .Right}}{{.Right}}{{else}}right{{end}}: {{.RightErr}}</p>
+    {{end}}
+    {{with .Summary}}
+    <p>
+      Equal: {{.Equal}}, different: {{.Different}},
+      left new: {{.LeftNew}}, right new: {{.RightNew}},
+      could not collect: {{.Errors}}
+      {{if or .LeftNewer .RightNewer}}
+      <br/>
+      {{if $.Right}}{{$.Right}}{{else}}right{{end}} is behind on {{.LeftNewer}},
+      {{if $.Left}}{{$.Left}}{{else}}left{{end}} is behind on {{.RightNewer}}
+      {{end}}
+    </p>
+    {{end}}
+    {{with .ChangeSummary}}
+    <p>
+      Of the different items:
+      {{range .}}<br/>{{.}}{{end}}
+    </p>
+    {{end}}
+{{end}}
+
+{{define "matrix"}}
+    {{range $host, $err := .Errs}}
+    <p class="alert alert-danger">Could not collect {{$host}}: {{$err}}</p>
+    {{end}}
+    {{with .Summary}}
+    <p>
+      Hosts agree on {{.Agree}} and disagree on {{.Disagree}} keys{{if .Errors}},
+      {{.Errors}} keys could not be collected on some hosts{{end}}.
+      {{range $i, $n := .Outliers}}{{if $n}}
+      <br/>{{index $.Hosts $i}} is an outlier on {{$n}}
+      {{end}}{{end}}
+    </p>
+    {{end}}
+{{end}}
+
+{{define "report"}}
+<!DOCTYPE html>
+<html lang="en" dir="ltr">
+  <head>
+    <title>{{.Title}}</title>
+    <meta charset="utf-8">
+    <style>` + reportCSS + `    </style>
+    <script>` + reportJS + `    </script>
+  </head>
+  <body>
+    <div class="fixed-top tbar">
+      Show:
+      <button class="btn btn-success off"
+              type="button"
+              data-toggle="filter"
+              data-type="=">Equal</button>
+      <button class="btn btn-warning"
+              type="button"
+              data-toggle="filter"
+              data-type="x">Different</button>
+      <button class="btn btn-primary"
+              type="button"
+              data-toggle="filter"
+              data-type="<">Left New</button>
+      <button class="btn btn-danger"
+              type="button"
+              data-toggle="filter"
+              data-type=">">Right New</button>
+      <button class="btn btn-secondary"
+              type="button"
+              data-toggle="filter"
+              data-type="?">Errors</button>
+      <input id="search" type="search" placeholder="Search keys and values">
+    </div>
+    <br/><br/>
+    <h1>{{.Title}}</h1>
+    <p id="drift-status">Loading...</p>
+    <ul class="nav nav-tabs">
+      <li class="nav-item">
+        <a class="nav-link active" data-toggle="tab" href="#overview">Overview</a>
+      </li>
+      {{range .Sections}}
+      <li class="nav-item">
+        <a class="nav-link" data-toggle="tab" href="#{{.Name}}">{{.Name}}</a>
+      </li>
+      {{end}}
+    </ul>
+    <div class="tab-content">
+      <div class="tab-pane active" id="overview">
+        <table class="table table-sm">
+          <thead>
+            <tr>
+              <th>Checker</th>
+              <th>Equal</th>
+              <th>Different</th>
+              <th>Left new</th>
+              <th>Right new</th>
+              <th>Could not collect</th>
+            </tr>
+          </thead>
+          <tbody>
+            {{range .Sections}}
+            <tr>
+              <td>{{.Name}}</td>
+              {{with .Diff}}{{with .Summary}}
+              <td>{{.Equal}}</td>
+              <td>{{.Different}}</td>
+              <td>{{.LeftNew}}</td>
+              <td>{{.RightNew}}</td>
+              <td>{{.Errors}}</td>
+              {{end}}{{end}}
+              {{with .Multi}}
+              <td>{{.Summary.Agree}}</td>
+              <td colspan="3">{{.Summary.Disagree}}</td>
+              <td>{{len .Errs}} hosts, {{.Summary.Errors}} keys</td>
+              {{end}}
+            </tr>
+            {{end}}
+          </tbody>
+        </table>
+      </div>
+      {{range .Sections}}
+      <div class="tab-pane" id="{{.Name}}">
+        {{with .Diff}}{{template "diff" .}}{{end}}
+        {{with .Multi}}{{template "matrix" .}}{{end}}
+        <div id="viewer-{{.Name}}"></div>
+      </div>
+      {{end}}
+    </div>
+    <div hidden id="drift-data">{{.Data}}</div>
+  </body>
+</html>
+{{end}}
+`
@@ -0,0 +1,209 @@
+package differ
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// ANSI colors of the terminal output.
+const (
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	blue   = "\x1b[34m"
+	cyan   = "\x1b[36m"
+	gray   = "\x1b[90m"
+	reset  = "\x1b[0m"
+)
+
+// painter colors text for the terminal, or leaves it as is.
+type painter bool
+
+func (color painter) paint(c, s string) string {
+	if !color || s == "" {
+		return s
+	}
+	return c + s + reset
+}
+
+// count paints a nonzero count.
+func (color painter) count(c string, n int, width int) string {
+	s := fmt.Sprintf("%*d", width, n)
+	if n == 0 {
+		return s
+	}
+	return color.paint(c, s)
+}
+
+// topKey is a key on which the hosts differ, as ranked for the summary.
+type topKey struct {
+	checker string
+	key     string
+	text    string
+	// weight ranks the keys, the ones differing in most aspects first.
+	weight int
+}
+
+// WriteSummary writes the counts of every checker of the report as a table,
+// followed by the top differing keys, at most top of them. The keys
+// differing in most aspects come first, and for a group of hosts the ones
+// with most different values. With color set the counts are colored like
+// in the html report.
+func WriteSummary(w io.Writer, r Report, top int, color bool) error {
+	c := painter(color)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-16s %9s %9s %9s %10s %9s\n", "Checker", "Equal", "Different",
+		"Left only", "Right only", "Errors")
+	var keys []topKey
+	for _, s := range r.Sections {
+		if dr := s.Diff; dr != nil {
+			sum := dr.Summary()
+			errs := sum.Errors
+			if dr.LeftErr != "" || dr.RightErr != "" {
+				errs++
+			}
+			fmt.Fprintf(bw, "%-16s %s %s %s %s %s\n", s.Name, c.count(green, sum.Equal, 9),
+				c.count(yellow, sum.Different, 9), c.count(blue, sum.LeftNew, 9),
+				c.count(red, sum.RightNew, 10), c.count(gray, errs, 9))
+			for _, dl := range dr.Diffs {
+				if dl.T != DIFFERENT {
+					continue
+				}
+				var changes []string
+				for _, ch := range dl.Changes() {
+					changes = append(changes, ch.String())
+				}
+				keys = append(keys, topKey{s.Name, dl.Left.Key, strings.Join(changes, ", "),
+					len(dl.Aspects())})
+			}
+		}
+		if mr := s.Multi; mr != nil {
+			sum := mr.Summary()
+			fmt.Fprintf(bw, "%-16s %s %s %9s %10s %s\n", s.Name, c.count(green, sum.Agree, 9),
+				c.count(yellow, sum.Disagree, 9), "-", "-", c.count(gray, sum.Errors+len(mr.Errs), 9))
+			for _, ml := range mr.Lines {
+				if ml.Agree() {
+					continue
+				}
+				var outliers []string
+				for i := range ml.Items {
+					if ml.Outlier(i) {
+						outliers = append(outliers, mr.Hosts[i])
+					}
+				}
+				text := ""
+				if len(outliers) > 0 {
+					text = "outliers: " + strings.Join(outliers, ", ")
+				}
+				keys = append(keys, topKey{s.Name, ml.Key, text, len(ml.Sizes)})
+			}
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].weight > keys[j].weight
+	})
+	if top > 0 && len(keys) > 0 {
+		if len(keys) > top {
+			keys = keys[:top]
+		}
+		fmt.Fprintln(bw, "\nTop differing keys:")
+		for _, k := range keys {
+			fmt.Fprintf(bw, "  %-16s %s  %s\n", k.checker, c.paint(yellow, k.key), k.text)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteText writes the report like a unified diff, without the equal lines:
+// items only on the left are prefixed with "-", only on the right with "+",
+// and different items appear on both sides. Items that could not be
+// collected are prefixed with "!". Every checker starts with a "@@" line
+// with its counts.
+//
+// For a group of hosts every key the hosts disagree on is followed by the
+// values of all hosts, the outliers prefixed with "!".
+func WriteText(w io.Writer, r Report, color bool) error {
+	c := painter(color)
+	bw := bufio.NewWriter(w)
+	for i, s := range r.Sections {
+		if dr := s.Diff; dr != nil {
+			left, right := sideName(dr.Left, "left"), sideName(dr.Right, "right")
+			if i == 0 {
+				fmt.Fprintln(bw, c.paint(red, "--- "+left))
+				fmt.Fprintln(bw, c.paint(green, "+++ "+right))
+			}
+			sum := dr.Summary()
+			fmt.Fprintln(bw, c.paint(cyan, fmt.Sprintf(
+				"@@ %s: %d equal, %d different, %d left only, %d right only, %d errors @@",
+				s.Name, sum.Equal, sum.Different, sum.LeftNew, sum.RightNew, sum.Errors)))
+			if dr.LeftErr != "" {
+				fmt.Fprintln(bw, c.paint(gray, "! could not collect "+left+": "+dr.LeftErr))
+			}
+			if dr.RightErr != "" {
+				fmt.Fprintln(bw, c.paint(gray, "! could not collect "+right+": "+dr.RightErr))
+			}
+			for _, dl := range dr.Diffs {
+				switch dl.T {
+				case EQUAL:
+					continue
+				case ERROR:
+					for _, p := range []struct {
+						side string
+						item checker.Pair
+					}{{left, dl.Left}, {right, dl.Right}} {
+						if p.item.Key != "" {
+							fmt.Fprintln(bw, c.paint(gray, fmt.Sprintf("!%s  %s: %s",
+								p.item.Key, p.side, cellText(p.item))))
+						}
+					}
+					continue
+				}
+				if dl.Left.Key != "" {
+					fmt.Fprintln(bw, c.paint(red, "-"+dl.Left.Key+"  "+cellText(dl.Left)))
+				}
+				if dl.Right.Key != "" {
+					fmt.Fprintln(bw, c.paint(green, "+"+dl.Right.Key+"  "+cellText(dl.Right)))
+				}
+			}
+		}
+		if mr := s.Multi; mr != nil {
+			sum := mr.Summary()
+			fmt.Fprintln(bw, c.paint(cyan, fmt.Sprintf(
+				"@@ %s: hosts agree on %d, disagree on %d, %d errors @@",
+				s.Name, sum.Agree, sum.Disagree, sum.Errors)))
+			var hosts []string
+			for host := range mr.Errs {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+			for _, host := range hosts {
+				fmt.Fprintln(bw, c.paint(gray, "! could not collect "+host+": "+mr.Errs[host]))
+			}
+			for _, ml := range mr.Lines {
+				if ml.Agree() {
+					continue
+				}
+				fmt.Fprintln(bw, " "+ml.Key)
+				for h, item := range ml.Items {
+					value := cellText(item)
+					if ml.Missing(h) {
+						value = "missing"
+					}
+					line := mr.Hosts[h] + ": " + value
+					if ml.Outlier(h) {
+						fmt.Fprintln(bw, c.paint(red, "!  "+line))
+					} else {
+						fmt.Fprintln(bw, "   "+line)
+					}
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,216 @@
+package differ
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two package versions of the form
+// [epoch:]version[-release] and returns -1, 0 or 1 if a is older than, equal
+// to or newer than b. The scheme selects the comparison rules: "dpkg" uses
+// Debian's rules, everything else uses rpm's, which pacman shares and which
+// are close enough for apk.
+func CompareVersions(scheme, a, b string) int {
+	if a == b {
+		return 0
+	}
+	cmp := rpmvercmp
+	if scheme == "dpkg" {
+		cmp = dpkgvercmp
+	}
+	ea, va, ra := splitEVR(a)
+	eb, vb, rb := splitEVR(b)
+	if c := compareInts(ea, eb); c != 0 {
+		return c
+	}
+	if c := cmp(va, vb); c != 0 {
+		return c
+	}
+	// rpm ignores the release when one of the sides doesn't have it
+	if scheme != "dpkg" && (ra == "" || rb == "") {
+		return 0
+	}
+	return cmp(ra, rb)
+}
+
+// splitEVR splits a version string into epoch, version and release. Missing
+// epoch is treated as 0, and the release is whatever follows the last dash.
+func splitEVR(s string) (epoch int, version, release string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(s[:i])
+		s = s[i+1:]
+	}
+	if i := strings.LastIndex(s, "-"); i >= 0 {
+		return epoch, s[:i], s[i+1:]
+	}
+	return epoch, s, ""
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// rpmvercmp is a port of rpm's segment based version comparison. Versions
+// are split into runs of digits and letters, separators are ignored, and a
+// tilde sorts before anything, even the end of the string.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) && !isAlpha(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isDigit(b[j]) && !isAlpha(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+		// tilde sorts before everything else
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		// caret sorts after the end of the string, but before anything else
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+		si, sj := i, j
+		isnum := isDigit(a[i])
+		if isnum {
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+		} else {
+			for i < len(a) && isAlpha(a[i]) {
+				i++
+			}
+			for j < len(b) && isAlpha(b[j]) {
+				j++
+			}
+		}
+		// segments of different types: numeric is newer
+		if sj == j {
+			if isnum {
+				return 1
+			}
+			return -1
+		}
+		segA, segB := a[si:i], b[sj:j]
+		if isnum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if c := compareInts(len(segA), len(segB)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i < len(a):
+		return 1
+	}
+	return -1
+}
+
+// dpkgorder gives the sort weight of a character in the non-digit parts of
+// a Debian version. Letters sort before non-letters and a tilde sorts before
+// everything, including the end of the part.
+func dpkgorder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// dpkgvercmp is a port of dpkg's verrevcmp.
+func dpkgvercmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := dpkgorder(a, i), dpkgorder(b, j)
+			if ac != bc {
+				return compareInts(ac, bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = compareInts(int(a[i]), int(b[j]))
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package differ
+
+import (
+	"testing"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		scheme string
+		a, b   string
+		want   int
+	}{
+		{"rpm", "1.2.10", "1.2.9", 1},
+		{"rpm", "1.2.9", "1.2.10", -1},
+		{"rpm", "1.0", "1.0", 0},
+		{"rpm", "1.0", "1.0.0", -1},
+		{"rpm", "1.0a", "1.0", 1},
+		{"rpm", "1.0", "1.a", 1},
+		{"rpm", "1.0~rc1", "1.0", -1},
+		{"rpm", "1.0~rc1", "1.0~rc2", -1},
+		{"rpm", "1.0^git1", "1.0", 1},
+		{"rpm", "1.0^git1", "1.0.1", -1},
+		{"rpm", "001", "1", 0},
+		{"rpm", "1:1.0-1", "2.0-1", 1},
+		{"rpm", "1.0.2k-19", "1.0.2k-21", -1},
+		{"rpm", "1.0.2k", "1.0.2k-21", 0},
+		{"dpkg", "1.2.10", "1.2.9", 1},
+		{"dpkg", "1.0~rc1", "1.0", -1},
+		{"dpkg", "1.0~~", "1.0~", -1},
+		{"dpkg", "1.0a", "1.0+", -1},
+		{"dpkg", "1:1.1.1n-0+deb11u4", "1.1.1n-0+deb11u5", 1},
+		{"dpkg", "1.1.1n-0+deb11u4", "1.1.1n-0+deb11u5", -1},
+		{"dpkg", "2.31-13+deb11u5", "2.31-13+deb11u5", 0},
+		{"dpkg", "1.0-1", "1.0-1~bpo1", 1},
+	}
+	for _, c := range cases {
+		if got := CompareVersions(c.scheme, c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%s, %s, %s) = %d, want %d", c.scheme, c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	pkg := func(key, version, release, vendor string) checker.Pair {
+		a := checker.Attrs{Name: key, Version: version, Release: release, Vendor: vendor}
+		return checker.Pair{Key: key, Attrs: a}
+	}
+	x := []checker.Pair{
+		pkg("bash", "5.1", "2", "CentOS"),
+		pkg("openssl", "1.0.2k", "19", "CentOS"),
+		pkg("zlib", "1.2.11", "3", "CentOS"),
+	}
+	y := []checker.Pair{
+		pkg("bash", "5.1", "2", "CentOS"),
+		pkg("openssl", "1.0.2k", "21", "CentOS"),
+		pkg("zlib", "1.2.11", "3", "Other"),
+	}
+	y[0].Attrs.InstallTime = 1669890436
+	dres, err := DiffPackages(x, y, "rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Newer{NEITHER, RIGHTNEWER, NEITHER}
+	for i, dl := range dres.Diffs {
+		if dl.Newer != expected[i] {
+			t.Errorf("%s: expected %d, got %d", dl.Left.Key, expected[i], dl.Newer)
+		}
+	}
+	if changed := dres.Diffs[2].Changed(); len(changed) != 1 || changed[0] != "Vendor" {
+		t.Errorf("Expected only Vendor to change, got %v", changed)
+	}
+	s := dres.Summary()
+	if s.Equal != 1 || s.Different != 2 || s.RightNewer != 1 || s.LeftNewer != 0 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+}
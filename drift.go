@@ -4,12 +4,36 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"syscall"
 
+	"github.com/pjovanovic05/drift/differ"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "snapshot":
+			snapshotCmd(os.Args[2:])
+			return
+		case "collect":
+			collectCmd(os.Args[2:])
+			return
+		case "diff":
+			diffCmd(os.Args[2:])
+			return
+		case "changes":
+			changesCmd(os.Args[2:])
+			return
+		case "timeline":
+			timelineCmd(os.Args[2:])
+			return
+		case "history":
+			historyCmd(os.Args[2:])
+			return
+		}
+	}
 	isServer := flag.Bool("d", false, "Run as daemon.")
 	host := flag.String("host", "0.0.0.0", "Server hostname or IP on which to listen to.")
 	port := flag.Int("port", 8000, "Server port.")
@@ -19,23 +43,155 @@ func main() {
 	passwd := flag.String("pass", "", "Password for clients to connect.")
 	cert := flag.String("cert", "", "cert file for the server")
 	key := flag.String("key", "", "key file for the server")
-	reportFN := flag.String("o", "drift-report.html",
-		"File name for the report to be generated.")
+	insecure := flag.Bool("insecure", false,
+		"Allow the daemon to run without a password.")
+	out := reportFlags(flag.CommandLine)
+	historyFN := flag.String("history", defaultHistory,
+		"History file to record the collected state in, empty to not record it.")
 	flag.Parse()
 	password := *passwd
 	if *askPass {
-		fmt.Print("Enter remote password: ")
+		fmt.Fprint(os.Stderr, "Enter remote password: ")
 		bytePass, err := terminal.ReadPassword(syscall.Stdin)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println() // newline after password input
+		fmt.Fprintln(os.Stderr) // newline after password input
 		password = string(bytePass)
 	}
 
 	if *isServer {
-		startServer(*host, *port, password, *cert, *key)
+		startServer(*host, *port, password, *cert, *key, *insecure)
 	} else {
-		startClient(*runConfig, *reportFN)
+		os.Exit(startClient(*runConfig, out(), *historyFN))
+	}
+}
+
+// reportFlags defines the flags telling where and how reports are written,
+// and which diffs fail the run. The returned function gives their values
+// once the flags are parsed.
+func reportFlags(fs *flag.FlagSet) func() reportOut {
+	file := fs.String("o", "", "File name for the report to be generated, - for the "+
+		"standard output. By default drift-report.<format>, the standard output for text.")
+	dir := fs.String("outdir", "",
+		"Directory to also write a separate report for every checker into.")
+	format := fs.String("format", "html",
+		"Report format: html, json, ndjson, csv, junit, sarif, text or markdown.")
+	top := fs.Int("top", 10, "Number of differing keys to list in the summary.")
+	maxRows := fs.Int("max-rows", 50,
+		"Rows to list per checker in markdown reports, 0 for all of them.")
+	failOn := fs.String("fail-on", "",
+		"Comma separated diff types (left-new, right-new, different, error, disagree) "+
+			"and checkers that fail the run, all by default.")
+	return func() reportOut {
+		ext, ok := formatExts[*format]
+		if !ok {
+			log.Fatalf("Unknown report format %q\n", *format)
+		}
+		if *file == "" && *format == "text" {
+			*file = "-"
+		} else if *file == "" {
+			*file = "drift-report" + ext
+		}
+		if *file == "-" {
+			notices = os.Stderr
+		}
+		policy := differ.ParsePolicy(*failOn)
+		for _, name := range policy.Checkers {
+			if _, ok := reportFiles[name]; !ok {
+				log.Fatalf("Unknown diff type or checker %q in -fail-on\n", name)
+			}
+		}
+		return reportOut{file: *file, dir: *dir, format: *format, failOn: policy, top: *top,
+			maxRows: *maxRows}
+	}
+}
+
+// snapshotCmd saves the state of one host to a snapshot file:
+// drift snapshot -config run-config.json -from web1 -out golden.snap
+func snapshotCmd(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	runConfig := fs.String("config", "run-config.json",
+		"JSON config of the checks to run and the host to collect.")
+	from := fs.String("from", "",
+		"Name of the host in the config to collect, Left by default.")
+	out := fs.String("out", "snapshot.snap", "File name for the snapshot.")
+	fs.Parse(args)
+	startSnapshot(*runConfig, *from, *out)
+}
+
+// collectCmd runs the checks locally and saves a snapshot, for hosts that
+// can't run the daemon: drift collect -config run-config.json -out host.snap
+func collectCmd(args []string) {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	runConfig := fs.String("config", "run-config.json", "JSON config of the checks to run.")
+	out := fs.String("out", "", "File name for the snapshot, host name by default.")
+	fs.Parse(args)
+	if *out == "" {
+		hostName, err := os.Hostname()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*out = hostName + ".snap"
+	}
+	startCollect(*runConfig, *out)
+}
+
+// diffCmd compares snapshot files: drift diff a.snap b.snap
+func diffCmd(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	historyFN := fs.String("history", defaultHistory,
+		"History file to record the run in, empty to not record it.")
+	out := reportFlags(fs)
+	fs.Parse(args)
+	os.Exit(startDiff(fs.Args(), out(), *historyFN))
+}
+
+// changesCmd diffs a host against its earlier state from the history:
+// drift changes -config run-config.json -host web1 -since 2022-12-01
+func changesCmd(args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	runConfig := fs.String("config", "run-config.json",
+		"JSON config of the checks to run and the host to collect.")
+	host := fs.String("host", "", "Name of the host in the config, Left by default.")
+	since := fs.String("since", "last",
+		`Earlier state to diff against: "last" run, or a date or RFC 3339 time.`)
+	historyFN := fs.String("history", defaultHistory, "History file.")
+	out := reportFlags(fs)
+	fs.Parse(args)
+	os.Exit(startChanges(*runConfig, *host, *since, out(), *historyFN))
+}
+
+// timelineCmd shows when keys of a host changed: drift timeline -host web1
+func timelineCmd(args []string) {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	host := fs.String("host", "", "Name of the host.")
+	checkerName := fs.String("checker", "", "Checker to show, e.g. FileChecker. All by default.")
+	historyFN := fs.String("history", defaultHistory, "History file.")
+	fs.Parse(args)
+	if *host == "" {
+		log.Fatal("Need the -host to show the timeline of.")
+	}
+	startTimeline(*host, *checkerName, *historyFN)
+}
+
+// historyCmd queries the history file:
+// drift history list, drift history show <id>
+func historyCmd(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	historyFN := fs.String("history", defaultHistory, "History file.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drift history [-history file] list | show <id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	switch {
+	case fs.Arg(0) == "list" && fs.NArg() == 1:
+		startHistoryList(*historyFN)
+	case fs.Arg(0) == "show" && fs.NArg() == 2:
+		startHistoryShow(*historyFN, fs.Arg(1))
+	default:
+		fs.Usage()
+		os.Exit(2)
 	}
 }
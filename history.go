@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pjovanovic05/drift/differ"
+	"github.com/pjovanovic05/drift/history"
+	"github.com/pjovanovic05/drift/snapshot"
+)
+
+// defaultHistory is the history file used unless told otherwise.
+const defaultHistory = "drift-history.db"
+
+func openHistory(historyFN string) *history.Store {
+	st, err := history.Open(historyFN)
+	if err != nil {
+		log.Fatalf("Opening history failed: %s\n", err)
+	}
+	return st
+}
+
+// recordHistory saves the results of the hosts that were collected live to
+// the history file and returns the IDs of their snapshot records, 0 for
+// hosts not recorded. Nothing is recorded without a history file. Failing
+// to record is only warned about, it doesn't fail the run.
+func recordHistory(historyFN string, hosts []Host, checks []check, results [][]collected,
+	managers map[string]string, snaps []*snapshot.Snapshot) []int {
+	ids := make([]int, len(hosts))
+	if historyFN == "" {
+		return ids
+	}
+	st, err := history.Open(historyFN)
+	if err != nil {
+		log.Printf("Warning: recording in history failed: %s\n", err)
+		return ids
+	}
+	for h, host := range hosts {
+		if h < len(snaps) && snaps[h] != nil {
+			continue
+		}
+		e, err := st.AddSnapshot(hostSnapshot(host, h, checks, results, managers))
+		if err != nil {
+			log.Printf("Warning: recording %s in history failed: %s\n", host.HostName, err)
+			continue
+		}
+		ids[h] = e.ID
+		fmt.Fprintf(notices, "Recorded snapshot %d of %s in %s\n", e.ID, host.HostName, historyFN)
+	}
+	return ids
+}
+
+// recordRun saves the run with the summaries of its diffs to the history
+// file. The snapshots are the IDs of the hosts' snapshot records. Like
+// recordHistory, it only warns when recording fails.
+func recordRun(historyFN, command string, runConfig RunConf, snapshots []int,
+	crs []history.CheckResult) {
+	if historyFN == "" {
+		return
+	}
+	conf, err := json.Marshal(runConfig.redacted())
+	if err != nil {
+		log.Printf("Warning: recording the run in history failed: %s\n", err)
+		return
+	}
+	run := history.Run{Command: command, Config: conf, Snapshots: snapshots, Checks: crs}
+	for _, host := range runConfig.hosts() {
+		run.Hosts = append(run.Hosts, host.HostName)
+	}
+	st, err := history.Open(historyFN)
+	if err != nil {
+		log.Printf("Warning: recording the run in history failed: %s\n", err)
+		return
+	}
+	e, err := st.AddRun(run, time.Now())
+	if err != nil {
+		log.Printf("Warning: recording the run in history failed: %s\n", err)
+		return
+	}
+	fmt.Fprintf(notices, "Recorded run %d in %s\n", e.ID, historyFN)
+}
+
+// startChanges collects the named host and diffs it against its snapshot
+// from the last run, or the last one taken at or before the given time.
+// The new state is recorded in the history too. It returns the exit status
+// of the run.
+func startChanges(runConf, hostName, since string, out reportOut, historyFN string) int {
+	runConfig := readRunConf(runConf)
+	host, ok := runConfig.findHost(hostName)
+	if !ok || host.Snapshot != "" {
+		log.Fatalf("No live host %s in the run configuration\n", hostName)
+	}
+	st := openHistory(historyFN)
+	t := time.Now()
+	if since != "last" {
+		var err error
+		if t, err = history.ParseTime(since); err != nil {
+			log.Fatal(err)
+		}
+	}
+	base, err := st.Before(host.HostName, t)
+	if err == history.ErrNotFound {
+		log.Fatalf("No snapshot of %s in history before %s\n", host.HostName,
+			t.Format(time.RFC3339))
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	baseSnap, err := st.Snapshot(base)
+	if err != nil {
+		log.Fatalf("Reading history failed: %s\n", err)
+	}
+
+	skipKeyVerify(host)
+	checks := runConfig.checks()
+	results, managers := collect([]Host{host}, checks, nil)
+
+	// the old state is the left side, the current one the right
+	then := Host{HostName: host.HostName + " (" + base.Time.Local().Format("2006-01-02 15:04") + ")"}
+	now := Host{HostName: host.HostName + " (now)"}
+	pairs := make([][]collected, len(checks))
+	pairManagers := map[string]string{now.HostName: managers[host.HostName]}
+	for i, c := range checks {
+		pairs[i] = []collected{fromSnapshot(&baseSnap, c), results[i][0]}
+		if sc, ok := baseSnap.Check(c.Name); ok && sc.Manager != "" {
+			pairManagers[then.HostName] = sc.Manager
+		}
+	}
+	rc := runConfig
+	rc.Left, rc.Right, rc.Hosts = then, now, nil
+	crs := writeReports(rc, checks, pairs, pairManagers, out)
+	ids := recordHistory(historyFN, []Host{host}, checks, results, managers, nil)
+	recordRun(historyFN, "changes", rc, []int{base.ID, ids[0]}, crs)
+	return exitStatus(crs, out.failOn)
+}
+
+// startTimeline prints when each key of the host first changed in its
+// history, for the named checker or all of them.
+func startTimeline(hostName, checkerName, historyFN string) {
+	st := openHistory(historyFN)
+	names := checkOrder
+	if checkerName != "" {
+		names = []string{checkerName}
+	}
+	for _, name := range names {
+		changes, err := st.Timeline(hostName, name)
+		if err != nil {
+			log.Fatalf("Reading history failed: %s\n", err)
+		}
+		for _, kc := range changes {
+			line := fmt.Sprintf("%s  %-14s %-8s %s", kc.Time.Local().Format("2006-01-02 15:04"),
+				name, changeWord(kc.T), kc.Key)
+			for _, c := range kc.Changes {
+				line += "  " + c.String()
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
+// changeWord tells how a key changed between an older (left) and a newer
+// (right) state.
+func changeWord(t differ.DiffType) string {
+	switch t {
+	case differ.LEFTNEW:
+		return "removed"
+	case differ.RIGHTNEW:
+		return "added"
+	case differ.ERROR:
+		return "error"
+	}
+	return "changed"
+}
+
+// startHistoryList prints the records of the history file.
+func startHistoryList(historyFN string) {
+	st := openHistory(historyFN)
+	entries, err := st.Entries()
+	if err != nil {
+		log.Fatalf("Reading history failed: %s\n", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tKIND\tDETAILS")
+	for _, e := range entries {
+		details := e.Host
+		if e.Kind == history.RunKind {
+			run, err := st.Run(e)
+			if err != nil {
+				log.Fatalf("Reading history failed: %s\n", err)
+			}
+			details = run.Command + " " + strings.Join(run.Hosts, ", ") + ": " + driftSummary(run)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"),
+			e.Kind, details)
+	}
+	tw.Flush()
+}
+
+// driftSummary tells which checkers found drift in the run, and which could
+// not collect everything.
+func driftSummary(run history.Run) string {
+	var drifted, uncollected []string
+	for _, cr := range run.Checks {
+		if cr.Drift() {
+			drifted = append(drifted, cr.Checker)
+		}
+		if cr.Uncollected() {
+			uncollected = append(uncollected, cr.Checker)
+		}
+	}
+	summary := "no drift"
+	if len(drifted) > 0 {
+		summary = "drift in " + strings.Join(drifted, ", ")
+	}
+	if len(uncollected) > 0 {
+		summary += ", could not collect all of " + strings.Join(uncollected, ", ")
+	}
+	return summary
+}
+
+// startHistoryShow prints a run or a snapshot from the history file.
+func startHistoryShow(historyFN, id string) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		log.Fatalf("Bad record ID %q\n", id)
+	}
+	st := openHistory(historyFN)
+	e, err := st.Get(n)
+	if err != nil {
+		log.Fatalf("Record %d: %s\n", n, err)
+	}
+	when := e.Time.Local().Format("2006-01-02 15:04:05")
+	if e.Kind == history.SnapshotKind {
+		s, err := st.Snapshot(e)
+		if err != nil {
+			log.Fatalf("Reading history failed: %s\n", err)
+		}
+		fmt.Printf("Snapshot %d of %s at %s\n", e.ID, s.Host, when)
+		for _, sc := range s.Checks {
+			line := fmt.Sprintf("  %s: %d items", sc.Checker, len(sc.Pairs))
+			if sc.Manager != "" {
+				line += " (" + sc.Manager + ")"
+			}
+			if sc.Err != "" {
+				line += ", could not collect: " + sc.Err
+			}
+			fmt.Println(line)
+		}
+		return
+	}
+
+	run, err := st.Run(e)
+	if err != nil {
+		log.Fatalf("Reading history failed: %s\n", err)
+	}
+	fmt.Printf("Run %d (%s) at %s\n", e.ID, run.Command, when)
+	fmt.Println("Hosts:")
+	for h, host := range run.Hosts {
+		if h < len(run.Snapshots) && run.Snapshots[h] != 0 {
+			fmt.Printf("  %s (snapshot %d)\n", host, run.Snapshots[h])
+		} else {
+			fmt.Printf("  %s\n", host)
+		}
+	}
+	for _, cr := range run.Checks {
+		fmt.Printf("%s:\n", cr.Checker)
+		if s := cr.Summary; s != nil {
+			fmt.Printf("  equal: %d, different: %d, left new: %d, right new: %d, "+
+				"could not collect: %d\n", s.Equal, s.Different, s.LeftNew, s.RightNew, s.Errors)
+		}
+		for _, cc := range cr.Changes {
+			fmt.Printf("  %s\n", cc)
+		}
+		if s := cr.Fleet; s != nil {
+			fmt.Printf("  hosts agree on %d keys and disagree on %d\n", s.Agree, s.Disagree)
+			if s.Errors > 0 {
+				fmt.Printf("  %d keys could not be collected on some hosts\n", s.Errors)
+			}
+			for h, n := range s.Outliers {
+				if n > 0 && h < len(cr.FleetHosts) {
+					fmt.Printf("  %s is an outlier on %d keys\n", cr.FleetHosts[h], n)
+				}
+			}
+		}
+		for host, err := range cr.Errs {
+			fmt.Printf("  could not collect %s: %s\n", host, err)
+		}
+	}
+	var conf bytes.Buffer
+	if json.Indent(&conf, run.Config, "  ", "  ") == nil {
+		fmt.Printf("Config:\n  %s\n", conf.String())
+	}
+}
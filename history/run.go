@@ -0,0 +1,69 @@
+package history
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pjovanovic05/drift/differ"
+)
+
+// Run is a comparison of hosts made by the client.
+type Run struct {
+	// Command is what was run, e.g. "compare", "diff" or "changes".
+	Command string
+	// Config is the run configuration, without passwords.
+	Config json.RawMessage `json:",omitempty"`
+	Hosts  []string
+	// Snapshots are the IDs of the snapshot records of the hosts, in the
+	// order of Hosts. Hosts that were not recorded, e.g. because they were
+	// read from a snapshot file, have 0.
+	Snapshots []int
+	Checks    []CheckResult
+}
+
+// CheckResult sums up the diff of one checker in a run.
+type CheckResult struct {
+	Checker string
+	// Summary and Changes are set when two hosts were compared.
+	Summary *differ.Summary      `json:",omitempty"`
+	Changes []differ.ChangeCount `json:",omitempty"`
+	// Fleet is set when a group of hosts was compared. Its outliers are in
+	// the order of FleetHosts, the hosts that could be collected.
+	Fleet      *differ.MultiSummary `json:",omitempty"`
+	FleetHosts []string             `json:",omitempty"`
+	// Errs tells why hosts could not be collected, by host name.
+	Errs map[string]string `json:",omitempty"`
+}
+
+// Drift tells if the hosts differ.
+func (cr CheckResult) Drift() bool {
+	if s := cr.Summary; s != nil && s.Different+s.LeftNew+s.RightNew > 0 {
+		return true
+	}
+	return cr.Fleet != nil && cr.Fleet.Disagree > 0
+}
+
+// Uncollected tells if hosts or items could not be collected.
+func (cr CheckResult) Uncollected() bool {
+	if len(cr.Errs) > 0 {
+		return true
+	}
+	if s := cr.Summary; s != nil && s.Errors > 0 {
+		return true
+	}
+	return cr.Fleet != nil && cr.Fleet.Errors > 0
+}
+
+// AddRun records a run made at time t.
+func (st *Store) AddRun(r Run, t time.Time) (Entry, error) {
+	return st.add(Entry{Kind: RunKind, Time: t}, r)
+}
+
+// Run loads the run of a record.
+func (st *Store) Run(e Entry) (r Run, err error) {
+	if e.Kind != RunKind {
+		return r, fmtKindErr(e, RunKind)
+	}
+	err = st.load(e, &r)
+	return r, err
+}
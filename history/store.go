@@ -0,0 +1,290 @@
+// Package history keeps snapshots of hosts over time in a single file, so
+// the state of a host can be compared with an earlier one. The runs of the
+// client are recorded there too, with the summaries of their diffs.
+//
+// The store file starts with a magic header, followed by records appended
+// one after another. Every record is made of a small JSON entry describing
+// it and a gzip compressed JSON payload. Both are prefixed with their length,
+// so entries can be listed without reading the payloads.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pjovanovic05/drift/snapshot"
+)
+
+const magic = "DRIFTDB\x01"
+
+// Kinds of records.
+const (
+	SnapshotKind = "snapshot"
+	RunKind      = "run"
+)
+
+// ErrNotFound is returned when no record matches the query.
+var ErrNotFound = errors.New("not found in history")
+
+// Entry describes a record in the store.
+type Entry struct {
+	// ID numbers the records in the order they were added, starting at 1.
+	ID   int
+	Kind string
+	// Host is the host the snapshot was taken of.
+	Host string `json:",omitempty"`
+	Time time.Time
+	// offset and size locate the payload in the file.
+	offset int64
+	size   int64
+}
+
+// Store is a history file.
+type Store struct {
+	path string
+}
+
+// Open opens the history file, creating it if it doesn't exist.
+func Open(path string) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, len(magic))
+	n, err := io.ReadFull(f, head)
+	switch {
+	case n == 0 && err == io.EOF:
+		_, err = f.Write([]byte(magic))
+	case err != nil || string(head) != magic:
+		err = fmt.Errorf("%s is not a drift history file", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path}, nil
+}
+
+// Entries lists all records in the order they were added. An incomplete
+// last record, left by a write that was interrupted, is ignored.
+func (st *Store) Entries() ([]Entry, error) {
+	f, err := os.Open(st.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+	entries, _, err := readEntries(f)
+	return entries, err
+}
+
+// readEntries reads the entries of the records in the file and returns
+// them with the offset where the complete records end.
+func readEntries(f *os.File) (entries []Entry, end int64, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	end = int64(len(magic))
+	if _, err = f.Seek(end, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	r := bufio.NewReader(f)
+	for {
+		var metaLen uint32
+		if err = binary.Read(r, binary.BigEndian, &metaLen); err != nil {
+			return entries, end, tornTail(err)
+		}
+		meta := make([]byte, metaLen)
+		if _, err = io.ReadFull(r, meta); err != nil {
+			return entries, end, tornTail(err)
+		}
+		var size uint64
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+			return entries, end, tornTail(err)
+		}
+		var e Entry
+		e.offset = end + 4 + int64(metaLen) + 8
+		e.size = int64(size)
+		if e.offset+e.size > fi.Size() {
+			// the payload was cut short
+			return entries, end, nil
+		}
+		if err = json.Unmarshal(meta, &e); err != nil {
+			return entries, end, err
+		}
+		end = e.offset + e.size
+		// skip the payload
+		if _, err = f.Seek(end, io.SeekStart); err != nil {
+			return entries, end, err
+		}
+		r.Reset(f)
+		entries = append(entries, e)
+	}
+}
+
+// tornTail hides the error of reading past the end of the file, which only
+// means the last record is incomplete or there are no more records.
+func tornTail(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// Get finds a record by its ID.
+func (st *Store) Get(id int) (Entry, error) {
+	entries, err := st.Entries()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// add appends a record with the payload encoded as JSON and returns its
+// entry. The file is locked while appending, so concurrent runs get their
+// own IDs, and an incomplete last record is overwritten.
+func (st *Store) add(e Entry, payload interface{}) (Entry, error) {
+	var data bytes.Buffer
+	zw := gzip.NewWriter(&data)
+	if err := json.NewEncoder(zw).Encode(payload); err != nil {
+		return e, err
+	}
+	if err := zw.Close(); err != nil {
+		return e, err
+	}
+
+	f, err := os.OpenFile(st.path, os.O_RDWR, 0644)
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return e, err
+	}
+	entries, end, err := readEntries(f)
+	if err != nil {
+		return e, err
+	}
+	e.ID = len(entries) + 1
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	var rec bytes.Buffer
+	binary.Write(&rec, binary.BigEndian, uint32(len(meta)))
+	rec.Write(meta)
+	binary.Write(&rec, binary.BigEndian, uint64(data.Len()))
+	rec.Write(data.Bytes())
+
+	if err = f.Truncate(end); err != nil {
+		return e, err
+	}
+	if _, err = f.WriteAt(rec.Bytes(), end); err != nil {
+		return e, err
+	}
+	e.offset = end + 4 + int64(len(meta)) + 8
+	e.size = int64(data.Len())
+	return e, f.Close()
+}
+
+// load decodes the payload of a record into v.
+func (st *Store) load(e Entry, v interface{}) error {
+	f, err := os.Open(st.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(io.NewSectionReader(f, e.offset, e.size))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return json.NewDecoder(zr).Decode(v)
+}
+
+// AddSnapshot records the snapshot of a host.
+func (st *Store) AddSnapshot(s snapshot.Snapshot) (Entry, error) {
+	s.Version = snapshot.FormatVersion
+	return st.add(Entry{Kind: SnapshotKind, Host: s.Host, Time: s.Created}, s)
+}
+
+// Snapshot loads the snapshot of a record.
+func (st *Store) Snapshot(e Entry) (s snapshot.Snapshot, err error) {
+	if e.Kind != SnapshotKind {
+		return s, fmtKindErr(e, SnapshotKind)
+	}
+	err = st.load(e, &s)
+	return s, err
+}
+
+func fmtKindErr(e Entry, kind string) error {
+	return fmt.Errorf("record %d is a %s, not a %s", e.ID, e.Kind, kind)
+}
+
+// Snapshots lists the snapshots of the host, oldest first.
+func (st *Store) Snapshots(host string) ([]Entry, error) {
+	entries, err := st.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var snaps []Entry
+	for _, e := range entries {
+		if e.Kind == SnapshotKind && e.Host == host {
+			snaps = append(snaps, e)
+		}
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].Time.Before(snaps[j].Time)
+	})
+	return snaps, nil
+}
+
+// Before finds the last snapshot of the host taken at or before t.
+func (st *Store) Before(host string, t time.Time) (Entry, error) {
+	snaps, err := st.Snapshots(host)
+	if err != nil {
+		return Entry{}, err
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if !snaps[i].Time.After(t) {
+			return snaps[i], nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// ParseTime parses a point in history given as RFC 3339 time, a date
+// (2006-01-02) or a date and time (2006-01-02 15:04) in local time. A date
+// stands for its end, so the snapshots taken on that day count.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, errors.New("can't parse time " + strconv.Quote(s))
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
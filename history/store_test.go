@@ -0,0 +1,216 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+	"github.com/pjovanovic05/drift/differ"
+	"github.com/pjovanovic05/drift/snapshot"
+)
+
+func tempStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := Open(filepath.Join(dir, "drift-history.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return st, func() { os.RemoveAll(dir) }
+}
+
+func files(host string, created time.Time, hashes ...string) snapshot.Snapshot {
+	var ps []checker.Pair
+	for i, h := range hashes {
+		if h != "" {
+			key := "/etc/" + string(rune('a'+i))
+			ps = append(ps, checker.Pair{Key: key, Attrs: checker.Attrs{Type: "file", Hash: h}})
+		}
+	}
+	return snapshot.Snapshot{Host: host, Created: created,
+		Checks: []snapshot.Check{{Checker: "FileChecker", Pairs: ps}}}
+}
+
+func TestStore(t *testing.T) {
+	st, cleanup := tempStore(t)
+	defer cleanup()
+	day := func(d int) time.Time { return time.Date(2022, 12, d, 10, 0, 0, 0, time.UTC) }
+	for _, s := range []snapshot.Snapshot{
+		files("web1", day(1), "aa", "bb"),
+		files("web2", day(1), "aa"),
+		files("web1", day(3), "aa", "b2"),
+	} {
+		if _, err := st.AddSnapshot(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reopening keeps the records
+	st, err := Open(st.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := st.Snapshots("web1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].ID != 1 || snaps[1].ID != 3 {
+		t.Fatalf("Unexpected web1 snapshots: %+v", snaps)
+	}
+	e, err := st.Before("web1", day(2))
+	if err != nil || e.ID != 1 {
+		t.Errorf("Before day 2: %+v, %v", e, err)
+	}
+	if _, err := st.Before("web1", day(1).Add(-time.Hour)); err != ErrNotFound {
+		t.Errorf("Expected no snapshot before the first one: %v", err)
+	}
+	s, err := st.Snapshot(snaps[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc, _ := s.Check("FileChecker"); len(sc.Pairs) != 2 || sc.Pairs[1].Attrs.Hash != "b2" {
+		t.Errorf("Unexpected snapshot: %+v", s)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	st, cleanup := tempStore(t)
+	defer cleanup()
+	day := func(d int) time.Time { return time.Date(2022, 12, d, 10, 0, 0, 0, time.UTC) }
+	for _, s := range []snapshot.Snapshot{
+		files("web1", day(1), "aa", "bb", ""),
+		files("web1", day(2), "aa", "b2", ""),
+		files("web1", day(3), "a3", "b3", "cc"),
+	} {
+		if _, err := st.AddSnapshot(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tl, err := st.Timeline("web1", "FileChecker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		key string
+		day int
+		t   differ.DiffType
+	}{{"/etc/b", 2, differ.DIFFERENT}, {"/etc/a", 3, differ.DIFFERENT}, {"/etc/c", 3, differ.RIGHTNEW}}
+	if len(tl) != len(want) {
+		t.Fatalf("Unexpected timeline: %+v", tl)
+	}
+	for i, w := range want {
+		if tl[i].Key != w.key || !tl[i].Time.Equal(day(w.day)) || tl[i].T != w.t {
+			t.Errorf("Timeline entry %d: %+v, want %+v", i, tl[i], w)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	end, err := ParseTime("2022-12-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Day() != 1 || end.Hour() != 23 {
+		t.Errorf("A date should stand for its end: %s", end)
+	}
+	if _, err := ParseTime("last week"); err == nil {
+		t.Error("Parsed an invalid time")
+	}
+}
+
+func TestRuns(t *testing.T) {
+	st, cleanup := tempStore(t)
+	defer cleanup()
+	snap, err := st.AddSnapshot(files("web1", time.Now(), "aa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := Run{Command: "compare", Hosts: []string{"web1", "web2"}, Snapshots: []int{snap.ID, 0},
+		Checks: []CheckResult{{Checker: "FileChecker", Summary: &differ.Summary{Equal: 1}},
+			{Checker: "UserChecker", Errs: map[string]string{"web2": "connection refused"}}}}
+	e, err := st.AddRun(run, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Run(snap); err == nil {
+		t.Error("Loaded a snapshot as a run")
+	}
+	got, err := st.Run(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "compare" || got.Snapshots[0] != 1 || got.Checks[0].Drift() ||
+		got.Checks[0].Uncollected() || got.Checks[1].Drift() || !got.Checks[1].Uncollected() {
+		t.Errorf("Unexpected run: %+v", got)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	st, cleanup := tempStore(t)
+	defer cleanup()
+	now := time.Now()
+	if _, err := st.AddSnapshot(files("web", now, "1")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(st.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.AddSnapshot(files("web", now, "2")); err != nil {
+		t.Fatal(err)
+	}
+	// cut the second record short, like an interrupted write
+	if err = os.Truncate(st.path, fi.Size()+20); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := st.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected the complete record only, got %v, %v", entries, err)
+	}
+	e, err := st.AddSnapshot(files("web", now, "3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 2 {
+		t.Errorf("Expected the new record to get ID 2, got %d", e.ID)
+	}
+	s, err := st.Snapshot(e)
+	if err != nil || s.Checks[0].Pairs[0].Attrs.Hash != "3" {
+		t.Errorf("Reading the record after the torn one failed: %v, %v", s, err)
+	}
+}
+
+func TestConcurrentAdds(t *testing.T) {
+	st, cleanup := tempStore(t)
+	defer cleanup()
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := st.AddSnapshot(files("web", time.Now(), "1"))
+			errs <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := st.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if e.ID != i+1 {
+			t.Errorf("Record %d got ID %d", i+1, e.ID)
+		}
+	}
+	if len(entries) != 8 {
+		t.Errorf("Expected 8 records, got %d", len(entries))
+	}
+}
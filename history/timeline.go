@@ -0,0 +1,67 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+	"github.com/pjovanovic05/drift/differ"
+)
+
+// KeyChange tells when a key first changed in the history of a host.
+type KeyChange struct {
+	Key  string
+	Time time.Time
+	// T is how the key changed: LEFTNEW when it was removed, RIGHTNEW when
+	// it was added, DIFFERENT when its value changed.
+	T differ.DiffType
+	// Changes are the attributes that changed, for DIFFERENT keys.
+	Changes []differ.Change `json:",omitempty"`
+}
+
+// Timeline goes through the snapshots of the host, oldest first, and tells
+// when each key of the checker first changed. Keys that never changed are
+// left out. Snapshots without the checker's results are skipped.
+func (st *Store) Timeline(host, checkerName string) ([]KeyChange, error) {
+	entries, err := st.Snapshots(host)
+	if err != nil {
+		return nil, err
+	}
+	var changes []KeyChange
+	seen := make(map[string]bool)
+	var prev []checker.Pair
+	started := false
+	for _, e := range entries {
+		s, err := st.Snapshot(e)
+		if err != nil {
+			return changes, err
+		}
+		sc, ok := s.Check(checkerName)
+		if !ok || sc.Err != "" {
+			continue
+		}
+		if started {
+			dr, err := differ.Diff(prev, sc.Pairs)
+			if err != nil {
+				return changes, err
+			}
+			for _, dl := range dr.Diffs {
+				key := dl.Left.Key
+				if key == "" {
+					key = dl.Right.Key
+				}
+				if dl.T == differ.EQUAL || seen[key] {
+					continue
+				}
+				seen[key] = true
+				changes = append(changes, KeyChange{Key: key, Time: s.Created, T: dl.T,
+					Changes: dl.Changes()})
+			}
+		}
+		prev, started = sc.Pairs, true
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	return changes, nil
+}
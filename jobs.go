@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// JobRequest is the body of a request to start a collection job.
+type JobRequest struct {
+	// Checker is the checker type name, e.g. FileChecker.
+	Checker string
+	// Config is passed to the checker. The optional "timeout" entry is a
+	// duration (e.g. "30m") after which the collection is stopped.
+	Config map[string]string
+}
+
+// Job is a single collection run of one checker on the server.
+type Job struct {
+	ID      string
+	Checker string
+	chk     checker.Checker
+	cancel  context.CancelFunc
+}
+
+// jobTTL is how long a finished job is kept for its client to fetch the
+// results. A client that dies before deleting the job would otherwise leave
+// its results in memory for good.
+const jobTTL = time.Hour
+
+// jobRegistry keeps the jobs started on this server, so several clients can
+// collect at the same time without sharing checker state.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// ttl is how long finished jobs are kept.
+	ttl time.Duration
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*Job), ttl: jobTTL}
+}
+
+// start creates a job for the requested checker and starts its collection
+// in the background.
+func (jr *jobRegistry) start(req JobRequest) (*Job, error) {
+	chk, err := checker.New(req.Checker)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	var timeout time.Duration
+	if t := req.Config["timeout"]; t != "" {
+		if timeout, err = time.ParseDuration(t); err != nil {
+			return nil, err
+		}
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	job := &Job{ID: id, Checker: req.Checker, chk: chk, cancel: cancel}
+	jr.mu.Lock()
+	jr.jobs[id] = job
+	jr.mu.Unlock()
+	go func() {
+		chk.Collect(ctx, req.Config)
+		// release the timer of a finished collection
+		cancel()
+	}()
+	return job, nil
+}
+
+// statusRep reports the progress of the job.
+func (job *Job) statusRep() StatusRep {
+	rep := StatusRep{ID: job.ID, Checker: job.Checker, Status: job.chk.Progress()}
+	if pc, ok := job.chk.(*checker.PackageChecker); ok {
+		rep.Manager = pc.Manager()
+	}
+	return rep
+}
+
+func (jr *jobRegistry) get(id string) (*Job, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	job, ok := jr.jobs[id]
+	return job, ok
+}
+
+// evict forgets the jobs that finished more than the TTL before now. The
+// status of the jobs is checked without holding the registry's lock, since
+// a checker may hold its own lock for a while.
+func (jr *jobRegistry) evict(now time.Time) {
+	jr.mu.Lock()
+	jobs := make([]*Job, 0, len(jr.jobs))
+	for _, job := range jr.jobs {
+		jobs = append(jobs, job)
+	}
+	jr.mu.Unlock()
+	for _, job := range jobs {
+		status := job.chk.Progress()
+		if status.Finished() && now.Sub(status.Ended) > jr.ttl {
+			jr.mu.Lock()
+			delete(jr.jobs, job.ID)
+			jr.mu.Unlock()
+		}
+	}
+}
+
+// evictEvery evicts the expired jobs at the interval.
+func (jr *jobRegistry) evictEvery(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		jr.evict(now)
+	}
+}
+
+// remove cancels the job if it is still running and forgets it. A job that
+// was still running is kept until it is evicted, so its status can tell it
+// was cancelled.
+func (jr *jobRegistry) remove(id string) bool {
+	job, ok := jr.get(id)
+	if !ok {
+		return false
+	}
+	job.cancel()
+	if job.chk.Progress().Finished() {
+		jr.mu.Lock()
+		delete(jr.jobs, id)
+		jr.mu.Unlock()
+	}
+	return true
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
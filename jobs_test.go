@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+func TestConcurrentJobs(t *testing.T) {
+	dirs := make([]string, 2)
+	for i := range dirs {
+		dir, err := ioutil.TempDir("", "drift")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for j := 0; j <= i; j++ {
+			fn := filepath.Join(dir, "file"+string('a'+rune(j)))
+			if err := ioutil.WriteFile(fn, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dirs[i] = dir
+	}
+
+	jr := newJobRegistry()
+	started := make([]*Job, len(dirs))
+	for i, dir := range dirs {
+		job, err := jr.start(JobRequest{Checker: "FileChecker",
+			Config: map[string]string{"path": dir}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		started[i] = job
+	}
+	if started[0].ID == started[1].ID {
+		t.Fatal("Jobs got the same ID.")
+	}
+	for i, job := range started {
+		deadline := time.Now().Add(5 * time.Second)
+		for !job.chk.Progress().Finished() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Job %s didn't finish.", job.ID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		status := job.chk.Progress()
+		if status.State != checker.Done || status.Items != int64(i+2) || status.Ended.IsZero() {
+			t.Errorf("Job %d has unexpected status: %+v", i, status)
+		}
+		collected, err := job.chk.GetCollected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the dir itself and i+1 files
+		if len(collected) != i+2 {
+			t.Errorf("Job %d collected %d items, expected %d: %v", i, len(collected), i+2, collected)
+		}
+		if collected[0].Key != dirs[i] {
+			t.Errorf("Job %d collected results of another job: %v", i, collected)
+		}
+	}
+
+	if _, err := jr.start(JobRequest{Checker: "NoSuchChecker"}); err == nil {
+		t.Error("Expected an error for an unknown checker.")
+	}
+	if !jr.remove(started[0].ID) {
+		t.Error("Removing a job failed.")
+	}
+	if _, ok := jr.get(started[0].ID); ok {
+		t.Error("Removed job is still registered.")
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	jr := newJobRegistry()
+	job, err := jr.start(JobRequest{Checker: "FileChecker",
+		Config: map[string]string{"path": os.TempDir(), "timeout": "1ns"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !job.chk.Progress().Finished() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out job didn't stop.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := job.chk.GetErr(); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if state := job.chk.Progress().State; state != checker.Failed {
+		t.Errorf("Expected failed state, got %s", state)
+	}
+
+	if _, err := jr.start(JobRequest{Checker: "FileChecker",
+		Config: map[string]string{"timeout": "soon"}}); err == nil {
+		t.Error("Expected an error for a malformed timeout.")
+	}
+}
+
+func TestJobEviction(t *testing.T) {
+	jr := newJobRegistry()
+	job, err := jr.start(JobRequest{Checker: "FileChecker",
+		Config: map[string]string{"path": os.TempDir(), "timeout": "1ns"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !job.chk.Progress().Finished() {
+		if time.Now().After(deadline) {
+			t.Fatal("Job didn't finish.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	jr.evict(time.Now())
+	if _, ok := jr.get(job.ID); !ok {
+		t.Fatal("Job was evicted before its TTL.")
+	}
+	jr.evict(time.Now().Add(jobTTL + time.Minute))
+	if _, ok := jr.get(job.ID); ok {
+		t.Error("Finished job was not evicted after its TTL.")
+	}
+}
+
+func TestRemoveRunningJob(t *testing.T) {
+	jr := newJobRegistry()
+	cancelled := false
+	job := &Job{ID: "running", Checker: "FileChecker", chk: &checker.FileChecker{},
+		cancel: func() { cancelled = true }}
+	jr.jobs[job.ID] = job
+	if !jr.remove(job.ID) || !cancelled {
+		t.Fatal("Removing a running job didn't cancel it.")
+	}
+	if _, ok := jr.get(job.ID); !ok {
+		t.Error("Cancelled job should be kept until it is evicted.")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pjovanovic05/drift/snapshot"
+)
+
+// startCollect runs the configured checks on this machine and saves the
+// results to a snapshot file, for hosts the client can't reach. The
+// snapshot can be carried over and compared with startDiff.
+func startCollect(runConf, out string) {
+	runConfig := readRunConf(runConf)
+	hostName, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err)
+	}
+	host := Host{HostName: hostName}
+
+	// local jobs run the same way as on the server
+	registry := newJobRegistry()
+	checks := runConfig.checks()
+	started := make([]*Job, len(checks))
+	board := newProgressBoard(notices)
+	for i, c := range checks {
+		conf, err := checkConfig(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := registry.start(JobRequest{Checker: c.Name, Config: conf})
+		if err != nil {
+			log.Fatalf("Error starting %s: %s\n", c.Name, err)
+		}
+		started[i] = job
+		board.add(remoteJob{host: host, check: c, ID: job.ID})
+	}
+
+	manager := ""
+	for pending := true; pending; {
+		time.Sleep(time.Second)
+		pending = false
+		for _, job := range started {
+			rep := job.statusRep()
+			rep.Host = hostName
+			board.update(rep)
+			pending = pending || !rep.Finished()
+			if rep.Manager != "" {
+				manager = rep.Manager
+			}
+		}
+	}
+	s := snapshot.Snapshot{Host: hostName, Created: time.Now()}
+	for i, c := range checks {
+		pairs, err := started[i].chk.GetCollected()
+		if err != nil {
+			log.Printf("Could not collect %s: %s\n", c.Name, err)
+		}
+		s.Checks = append(s.Checks, snapshotCheck(c, collected{pairs, err}, manager))
+	}
+	if err := snapshot.Write(out, s); err != nil {
+		log.Fatalf("Writing snapshot failed: %s\n", err)
+	}
+	fmt.Fprintf(notices, "Saved snapshot of %s to %s\n", hostName, out)
+}
+
+// startDiff compares snapshot files and writes the same reports as the
+// client. Two snapshots are diffed as Left and Right, more are compared as
+// a group of hosts. It returns the exit status of the run.
+func startDiff(files []string, out reportOut, historyFN string) int {
+	var runConfig RunConf
+	switch {
+	case len(files) < 2:
+		log.Fatal("Need at least two snapshot files to diff.")
+	case len(files) == 2:
+		runConfig.Left = Host{Snapshot: files[0]}
+		runConfig.Right = Host{Snapshot: files[1]}
+	default:
+		for _, f := range files {
+			runConfig.Hosts = append(runConfig.Hosts, Host{Snapshot: f})
+		}
+	}
+	out.checkFormat(runConfig)
+	snaps := runConfig.loadSnapshots()
+
+	// check what any of the snapshots has, with the config it ran with
+	var checks []check
+	for _, name := range checkOrder {
+		for _, s := range snaps {
+			if sc, ok := s.Check(name); ok {
+				checks = append(checks, check{name, sc.Config, reportFiles[name]})
+				break
+			}
+		}
+	}
+	results, managers := collect(runConfig.hosts(), checks, snaps)
+	crs := writeReports(runConfig, checks, results, managers, out)
+	recordRun(historyFN, "diff", runConfig, make([]int, len(snaps)), crs)
+	return exitStatus(crs, out.failOn)
+}
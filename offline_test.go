@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+	"github.com/pjovanovic05/drift/differ"
+	"github.com/pjovanovic05/drift/history"
+	"github.com/pjovanovic05/drift/snapshot"
+)
+
+// driftedSnapshots writes two snapshots to the dir that differ in a file.
+func driftedSnapshots(t *testing.T, dir string) []string {
+	var files []string
+	for i, size := range []int64{1, 2} {
+		s := snapshot.Snapshot{Host: "web", Created: time.Now(), Checks: []snapshot.Check{{
+			Checker: "FileChecker", Config: map[string]string{"path": "/etc"},
+			Pairs: []checker.Pair{{Key: "/etc/a", Attrs: checker.Attrs{Type: "file", Size: size}}},
+		}}}
+		fn := filepath.Join(dir, []string{"a.snap", "b.snap"}[i])
+		if err := snapshot.Write(fn, s); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fn)
+	}
+	return files
+}
+
+func TestDiffToStdout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := driftedSnapshots(t, dir)
+
+	savedStdout, savedNotices := os.Stdout, notices
+	defer func() { os.Stdout, notices = savedStdout, savedNotices }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	read := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		read <- data
+	}()
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	out := reportFlags(fs)
+	if err = fs.Parse([]string{"-format", "json", "-o", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	status := startDiff(files, out(), "")
+	w.Close()
+	data := <-read
+
+	if status != exitDrift {
+		t.Errorf("Expected exit status %d, got %d", exitDrift, status)
+	}
+	var doc struct {
+		Checkers []struct{ Checker string }
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Standard output is not the JSON report: %s\n%s", err, data)
+	}
+	if len(doc.Checkers) != 1 || doc.Checkers[0].Checker != "FileChecker" {
+		t.Errorf("Unexpected report: %s", data)
+	}
+}
+
+func TestDiffWithBadHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := driftedSnapshots(t, dir)
+	bad := filepath.Join(dir, "bad.db")
+	if err = ioutil.WriteFile(bad, []byte("not a history file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	out := reportFlags(fs)
+	if err = fs.Parse([]string{"-format", "json", "-o", filepath.Join(dir, "report.json")}); err != nil {
+		t.Fatal(err)
+	}
+	if status := startDiff(files, out(), bad); status != exitDrift {
+		t.Errorf("Expected exit status %d with a bad history file, got %d", exitDrift, status)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	itemErr := history.CheckResult{Checker: "FileChecker",
+		Summary: &differ.Summary{Equal: 1, Errors: 1}}
+	drift := history.CheckResult{Checker: "UserChecker",
+		Fleet: &differ.MultiSummary{Agree: 1, Disagree: 1}}
+	cases := []struct {
+		crs    []history.CheckResult
+		policy string
+		want   int
+	}{
+		{[]history.CheckResult{itemErr}, "", exitUncollected},
+		{[]history.CheckResult{itemErr}, "different", exitNoDrift},
+		{[]history.CheckResult{drift}, "", exitDrift},
+		{[]history.CheckResult{drift, itemErr}, "", exitUncollected},
+		{[]history.CheckResult{drift, itemErr}, "disagree", exitDrift},
+	}
+	for i, c := range cases {
+		if got := exitStatus(c.crs, differ.ParsePolicy(c.policy)); got != c.want {
+			t.Errorf("Case %d: expected exit status %d, got %d", i, c.want, got)
+		}
+	}
+}
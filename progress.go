@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// progressBoard shows a progress bar for every job. On a terminal the bars
+// are redrawn in place, otherwise a line is printed when a job changes state.
+type progressBoard struct {
+	out   io.Writer
+	tty   bool
+	order []string
+	reps  map[string]StatusRep
+	drawn int
+}
+
+func newProgressBoard(out *os.File) *progressBoard {
+	return &progressBoard{
+		out:  out,
+		tty:  terminal.IsTerminal(int(out.Fd())),
+		reps: make(map[string]StatusRep),
+	}
+}
+
+// colorOut tells if the output to f can be colored: f is a terminal and
+// colors are not turned off with NO_COLOR.
+func colorOut(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && terminal.IsTerminal(int(f.Fd()))
+}
+
+// add registers a job, so bars keep the order in which jobs were started.
+func (pb *progressBoard) add(job remoteJob) {
+	pb.order = append(pb.order, job.ID)
+	pb.reps[job.ID] = StatusRep{Host: job.host.HostName, ID: job.ID, Checker: job.check.Name,
+		Status: checker.Status{State: checker.Pending}}
+}
+
+// update records the job status and redraws the board.
+func (pb *progressBoard) update(rep StatusRep) {
+	prev, ok := pb.reps[rep.ID]
+	if !ok {
+		pb.order = append(pb.order, rep.ID)
+	}
+	pb.reps[rep.ID] = rep
+	if !pb.tty {
+		if prev.State != rep.State {
+			fmt.Fprintln(pb.out, formatProgress(rep))
+		}
+		return
+	}
+	if pb.drawn > 0 {
+		fmt.Fprintf(pb.out, "\033[%dA", pb.drawn)
+	}
+	for _, id := range pb.order {
+		fmt.Fprintf(pb.out, "\033[2K%s\n", formatProgress(pb.reps[id]))
+	}
+	pb.drawn = len(pb.order)
+}
+
+const barWidth = 20
+
+// formatProgress formats a job status as a single line with a progress bar.
+func formatProgress(rep StatusRep) string {
+	var pct int64 = -1
+	switch {
+	case rep.State == checker.Done:
+		pct = 100
+	case rep.Total > 0:
+		pct = rep.Items * 100 / rep.Total
+		// the total is only an estimate
+		if pct > 99 {
+			pct = 99
+		}
+	}
+	bar := strings.Repeat("?", barWidth)
+	pctStr := "  ?%"
+	if pct >= 0 {
+		filled := int(pct) * barWidth / 100
+		bar = strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled)
+		pctStr = fmt.Sprintf("%3d%%", pct)
+	}
+	line := fmt.Sprintf("%-20s %-15s [%s] %s %8d items", rep.Host, rep.Checker, bar,
+		pctStr, rep.Items)
+	if rep.Bytes > 0 {
+		line += " " + formatBytes(rep.Bytes)
+	}
+	line += " " + string(rep.State)
+	if !rep.Started.IsZero() {
+		end := rep.Ended
+		if end.IsZero() {
+			end = time.Now()
+		}
+		line += " " + end.Sub(rep.Started).Round(time.Second).String()
+	}
+	if rep.Error != "" {
+		line += ": " + rep.Error
+	}
+	return line
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+func TestFormatProgress(t *testing.T) {
+	cases := []struct {
+		status checker.Status
+		want   []string
+	}{
+		{checker.Status{State: checker.Running, Items: 50, Total: 200},
+			[]string{"[#####---------------]", " 25%", "running"}},
+		{checker.Status{State: checker.Running, Items: 300, Total: 200},
+			[]string{" 99%"}},
+		{checker.Status{State: checker.Running, Items: 10},
+			[]string{"  ?%"}},
+		{checker.Status{State: checker.Done, Items: 10, Bytes: 3 * 1024 * 1024},
+			[]string{"[####################]", "100%", "3.0 MiB", "done"}},
+		{checker.Status{State: checker.Failed, Error: "boom"},
+			[]string{"failed: boom"}},
+	}
+	for _, c := range cases {
+		line := formatProgress(StatusRep{Host: "host", Checker: "FileChecker", Status: c.status})
+		for _, want := range c.want {
+			if !strings.Contains(line, want) {
+				t.Errorf("Expected %q in %q", want, line)
+			}
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/pjovanovic05/drift/checker"
 
@@ -12,34 +15,33 @@ import (
 )
 
 var (
-	fc     checker.FileChecker
-	pmc    checker.PackageChecker
-	aclc   checker.ACLChecker
-	uc     checker.UserChecker
+	jobs   = newJobRegistry()
 	passwd string
 )
 
 //StatusRep is checker status report.
 type StatusRep struct {
-	Host     string
-	Progress string
+	Host    string
+	ID      string
+	Checker string
+	checker.Status
+	// Manager is the package manager backend, reported by PackageChecker.
+	Manager string `json:",omitempty"`
 }
 
-func startServer(host string, port int, password, cert, key string) {
+// ErrorRep is the body of error responses.
+type ErrorRep struct {
+	Error string
+}
+
+func startServer(host string, port int, password, cert, key string, insecure bool) {
+	if password == "" && !insecure {
+		log.Fatal("No password set for the daemon. Use -pass or -p, " +
+			"or -insecure to run without authentication.")
+	}
 	passwd = password
-	router := mux.NewRouter()
-	router.HandleFunc("/checkers/FileChecker/start", startFileChecker).Methods("POST")
-	router.HandleFunc("/checkers/FileChecker/status", getFCStatus).Methods("GET")
-	router.HandleFunc("/checkers/FileChecker/results", getFCResults).Methods("GET")
-	router.HandleFunc("/checkers/PackageChecker/start", startPackageChecker).Methods("POST")
-	router.HandleFunc("/checkers/PackageChecker/status", getPCStatus).Methods("GET")
-	router.HandleFunc("/checkers/PackageChecker/results", getPCResults).Methods("GET")
-	router.HandleFunc("/checkers/ACLChecker/start", startACLChecker).Methods("POST")
-	router.HandleFunc("/checkers/ACLChecker/status", getACLCStatus).Methods("GET")
-	router.HandleFunc("/checkers/ACLChecker/results", getACLCResults).Methods("GET")
-	router.HandleFunc("/checkers/UserChecker/start", startUserChecker).Methods("POST")
-	router.HandleFunc("/checkers/UserChecker/status", getUCStatus).Methods("GET")
-	router.HandleFunc("/checkers/UserChecker/results", getUCResults).Methods("GET")
+	go jobs.evictEvery(time.Minute)
+	router := newRouter()
 	// log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(port), router))
 	var err error
 	if len(cert) > 0 && len(key) > 0 {
@@ -53,13 +55,28 @@ func startServer(host string, port int, password, cert, key string) {
 	}
 }
 
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/jobs", basicAuth(startJob)).Methods("POST")
+	router.HandleFunc("/jobs/{id}", basicAuth(getJobStatus)).Methods("GET")
+	router.HandleFunc("/jobs/{id}/results", basicAuth(getJobResults)).Methods("GET")
+	router.HandleFunc("/jobs/{id}", basicAuth(deleteJob)).Methods("DELETE")
+	return router
+}
+
+// basicAuth requires the request to carry the admin credentials. Without a
+// password set (only allowed with -insecure) all requests are let through.
 func basicAuth(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if passwd == "" {
+			fn(w, r)
+			return
+		}
 		user, pass, ok := r.BasicAuth()
 		if !ok || !checkAuth(user, pass) {
 			w.Header().Set("WWW-Authenticate",
 				`Basic realm="please enter your username and password"`)
-			w.WriteHeader(401)
+			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte("Unauthorized.\n"))
 			return
 		}
@@ -67,139 +84,96 @@ func basicAuth(fn http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// checkAuth compares credentials in constant time, so response timing
+// doesn't leak how much of the password was right.
 func checkAuth(user, pass string) bool {
-	return user == "admin" && pass == passwd
-}
-
-func startFileChecker(w http.ResponseWriter, r *http.Request) {
-	config := make(map[string]string)
-	err := json.NewDecoder(r.Body).Decode(&config)
-	if err != nil {
-		log.Fatal(err)
-	}
-	go fc.Collect(config)
-	log.Println("Collecting files...")
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("{\"Status\": \"OK\"}\n"))
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte("admin"))
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(passwd))
+	return userOK&passOK == 1
 }
 
-func getFCStatus(w http.ResponseWriter, r *http.Request) {
-	rep := StatusRep{Progress: fc.Progress()}
-	data, err := json.Marshal(rep)
+// writeJSON responds with the value encoded as JSON.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(data)
 }
 
-func getFCResults(w http.ResponseWriter, r *http.Request) {
-	collected, err := fc.GetCollected()
-	if err != nil {
-		log.Fatal(err)
-	}
-	data, err := json.Marshal(collected)
-	if err != nil {
-		log.Fatal(err)
-	}
+// writeError responds with the error as a JSON ErrorRep.
+func writeError(w http.ResponseWriter, code int, err error) {
+	log.Printf("Request failed: %s\n", err)
+	data, _ := json.Marshal(ErrorRep{Error: err.Error()})
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(data)
 }
 
-func startPackageChecker(w http.ResponseWriter, r *http.Request) {
-	config := make(map[string]string)
-	config["manager"] = "rpm"
-	go pmc.Collect(config)
-	log.Println("Collecting packages...")
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("{\"Status\": \"OK\"}\n"))
-}
-
-func getPCStatus(w http.ResponseWriter, r *http.Request) {
-	rep := StatusRep{Progress: pmc.Progress()}
-	data, err := json.Marshal(rep)
-	if err != nil {
-		log.Fatal(err)
+// lookupJob finds the job addressed by the request, or responds with 404.
+func lookupJob(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobs.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("No such job: "+id))
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	return job, ok
 }
 
-func getPCResults(w http.ResponseWriter, r *http.Request) {
-	collected, err := pmc.GetCollected()
-	if err != nil {
-		log.Fatal(err)
-	}
-	data, err := json.Marshal(collected)
+// startJob starts a collection job and responds with its ID.
+func startJob(w http.ResponseWriter, r *http.Request) {
+	req := JobRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
-}
-
-func startACLChecker(w http.ResponseWriter, r *http.Request) {
-	config := make(map[string]string)
-	err := json.NewDecoder(r.Body).Decode(&config)
+	job, err := jobs.start(req)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
-	go aclc.Collect(config)
-	log.Println("Collecting acls...")
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("{\"Status\": \"OK\"}\n"))
+	log.Printf("Started %s job %s\n", job.Checker, job.ID)
+	writeJSON(w, http.StatusCreated, map[string]string{"ID": job.ID})
 }
 
-func getACLCStatus(w http.ResponseWriter, r *http.Request) {
-	rep := StatusRep{Progress: aclc.Progress()}
-	data, err := json.Marshal(rep)
-	if err != nil {
-		log.Fatal(err)
+func getJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := lookupJob(w, r)
+	if !ok {
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	writeJSON(w, http.StatusOK, job.statusRep())
 }
 
-func getACLCResults(w http.ResponseWriter, r *http.Request) {
-	collected, err := aclc.GetCollected()
-	if err != nil {
-		log.Fatal(err)
+func getJobResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := lookupJob(w, r)
+	if !ok {
+		return
 	}
-	data, err := json.Marshal(collected)
-	if err != nil {
-		log.Fatal(err)
+	// the collected results are only complete, and no longer changed by the
+	// checker, once the job has finished
+	if !job.chk.Progress().Finished() {
+		writeError(w, http.StatusConflict, errors.New("job "+job.ID+" is still running"))
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
-}
-
-func startUserChecker(w http.ResponseWriter, r *http.Request) {
-	config := make(map[string]string)
-	go uc.Collect(config)
-	log.Println("Collecting users...")
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("{\"Status\": \"OK\"}\n"))
-}
-
-func getUCStatus(w http.ResponseWriter, r *http.Request) {
-	rep := StatusRep{Progress: uc.Progress()}
-	data, err := json.Marshal(rep)
+	collected, err := job.chk.GetCollected()
 	if err != nil {
-		log.Fatal(err)
+		// cancelled and timed out jobs end up here too
+		writeError(w, http.StatusInternalServerError, err)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	writeJSON(w, http.StatusOK, collected)
 }
 
-func getUCResults(w http.ResponseWriter, r *http.Request) {
-	collected, err := uc.GetCollected()
-	if err != nil {
-		log.Fatal(err)
-	}
-	data, err := json.Marshal(collected)
-	if err != nil {
-		log.Fatal(err)
+// deleteJob cancels a running job, or forgets a finished one with its
+// collected results.
+func deleteJob(w http.ResponseWriter, r *http.Request) {
+	if _, ok := lookupJob(w, r); !ok {
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	jobs.remove(mux.Vars(r)["id"])
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+func TestBasicAuth(t *testing.T) {
+	saved := passwd
+	defer func() { passwd = saved }()
+	handler := basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cases := []struct {
+		passwd     string
+		user, pass string
+		setAuth    bool
+		want       int
+	}{
+		{"secret", "admin", "secret", true, http.StatusOK},
+		{"secret", "admin", "wrong", true, http.StatusUnauthorized},
+		{"secret", "root", "secret", true, http.StatusUnauthorized},
+		{"secret", "", "", false, http.StatusUnauthorized},
+		{"", "", "", false, http.StatusOK},
+	}
+	for _, c := range cases {
+		passwd = c.passwd
+		req := httptest.NewRequest("GET", "/jobs", nil)
+		if c.setAuth {
+			req.SetBasicAuth(c.user, c.pass)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("passwd %q, auth %s:%s: expected %d, got %d",
+				c.passwd, c.user, c.pass, c.want, rec.Code)
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	saved := passwd
+	defer func() { passwd = saved }()
+	passwd = ""
+	router := newRouter()
+	cases := []struct {
+		method, url, body string
+		want              int
+	}{
+		{"POST", "/jobs", "{not json", http.StatusBadRequest},
+		{"POST", "/jobs", `{"Checker": "NoSuchChecker"}`, http.StatusBadRequest},
+		{"GET", "/jobs/missing", "", http.StatusNotFound},
+		{"GET", "/jobs/missing/results", "", http.StatusNotFound},
+		{"DELETE", "/jobs/missing", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.url, c.want, rec.Code)
+		}
+		rep := ErrorRep{}
+		if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil || rep.Error == "" {
+			t.Errorf("%s %s: expected a JSON error, got %v", c.method, c.url, err)
+		}
+	}
+}
+
+func TestResultsOfRunningJob(t *testing.T) {
+	saved := passwd
+	defer func() { passwd = saved }()
+	passwd = ""
+	job := &Job{ID: "running", Checker: "FileChecker", chk: &checker.FileChecker{},
+		cancel: func() {}}
+	jobs.mu.Lock()
+	jobs.jobs[job.ID] = job
+	jobs.mu.Unlock()
+	defer jobs.remove(job.ID)
+
+	req := httptest.NewRequest("GET", "/jobs/running/results", nil)
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected %d for a running job, got %d", http.StatusConflict, rec.Code)
+	}
+}
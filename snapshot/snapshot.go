@@ -0,0 +1,109 @@
+// Package snapshot saves the collected state of a host to a file, so other
+// hosts can later be compared against it without it being online.
+//
+// A snapshot file is gzip compressed JSON of the Snapshot type. Reading also
+// accepts uncompressed JSON, so hand edited snapshots work too.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+// FormatVersion is the version of the snapshot format written by this
+// package. Snapshots with a newer version can't be read.
+const FormatVersion = 1
+
+// Snapshot is the collected state of one host.
+type Snapshot struct {
+	Version int
+	// Host is the name of the host the state was collected from.
+	Host    string
+	Created time.Time
+	Checks  []Check
+}
+
+// Check is the result of one checker run.
+type Check struct {
+	// Checker is the checker type name, e.g. FileChecker.
+	Checker string
+	// Config is the configuration the checker ran with.
+	Config map[string]string
+	// Manager is the package manager backend, set for PackageChecker.
+	Manager string `json:",omitempty"`
+	// Err tells why the state could not be collected.
+	Err   string `json:",omitempty"`
+	Pairs []checker.Pair
+}
+
+// Check finds the result of the named checker.
+func (s *Snapshot) Check(name string) (Check, bool) {
+	for _, c := range s.Checks {
+		if c.Checker == name {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// Write saves the snapshot to a file.
+func Write(path string, s Snapshot) error {
+	s.Version = FormatVersion
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(s)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Read loads a snapshot from a file.
+func Read(path string) (s Snapshot, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	s, err = Decode(f)
+	if err != nil {
+		return s, fmt.Errorf("%s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Decode reads a snapshot, compressed or not.
+func Decode(r io.Reader) (s Snapshot, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var in io.Reader = br
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return s, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+	if err = json.NewDecoder(in).Decode(&s); err != nil {
+		return s, err
+	}
+	if s.Version > FormatVersion {
+		return s, fmt.Errorf("snapshot format version %d is not supported", s.Version)
+	}
+	return s, nil
+}
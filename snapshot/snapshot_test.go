@@ -0,0 +1,58 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pjovanovic05/drift/checker"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golden.snap")
+	s := Snapshot{
+		Host:    "web1",
+		Created: time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC),
+		Checks: []Check{
+			{Checker: "FileChecker", Config: map[string]string{"path": "/etc"},
+				Pairs: []checker.Pair{{Key: "/etc", Attrs: checker.Attrs{Type: "dir"}}}},
+			{Checker: "UserChecker", Err: "permission denied"},
+		},
+	}
+	if err := Write(path, s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Version = FormatVersion
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("Read %+v, want %+v", got, s)
+	}
+	if c, ok := got.Check("UserChecker"); !ok || c.Err != "permission denied" {
+		t.Errorf("Unexpected UserChecker result: %+v", c)
+	}
+	if _, ok := got.Check("ACLChecker"); ok {
+		t.Error("Found a check that was not in the snapshot")
+	}
+}
+
+func TestDecodePlain(t *testing.T) {
+	s, err := Decode(strings.NewReader(`{"Version": 1, "Host": "web1"}`))
+	if err != nil || s.Host != "web1" {
+		t.Errorf("Decode plain JSON: %+v, %v", s, err)
+	}
+	if _, err := Decode(strings.NewReader(`{"Version": 99}`)); err == nil {
+		t.Error("Decoded snapshot with unsupported version")
+	}
+}